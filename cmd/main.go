@@ -1,16 +1,40 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"github.com/gofiber/fiber/v3"
-	"github.com/gofiber/fiber/v3/log"
 	"jwt-service/internal/config"
+	"jwt-service/internal/handlers"
+	"jwt-service/internal/logging"
+	"jwt-service/internal/metrics"
+	"jwt-service/internal/middleware"
+	"jwt-service/internal/repository"
 	"jwt-service/internal/router"
+	"jwt-service/internal/services/audit"
+	"jwt-service/internal/services/dpop"
+	"jwt-service/internal/services/health"
 	jwt_generator "jwt-service/internal/services/jwt-generator"
+	jwt_verifier "jwt-service/internal/services/jwt-verifier"
+	kill_switch "jwt-service/internal/services/kill-switch"
+	"jwt-service/internal/services/mtls"
+	"jwt-service/internal/services/oauth"
+	"jwt-service/internal/services/outbox"
+	rate_limit "jwt-service/internal/services/rate-limit"
+	"jwt-service/internal/services/sessions"
+	"jwt-service/internal/services/sink"
+	token_format "jwt-service/internal/services/token-format"
+	token_version "jwt-service/internal/services/token-version"
+	"jwt-service/internal/tracing"
 	"jwt-service/pkg/storage/postgres"
+	"log/slog"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/dev-timaracov/swagger-fiber-v3"
 
@@ -26,9 +50,37 @@ import (
 // @in header
 // @name Authorization
 func main() {
-	cfg := config.Load()
+	fs := flag.NewFlagSet("jwt-service", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "%s\nFlags:\n", usage)
+		fs.PrintDefaults()
+	}
+	cfg, err := config.Load(fs, os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if cfg == nil {
+		os.Exit(2)
+	}
+
+	args := fs.Args()
+	if len(args) > 0 && args[0] == "config" {
+		os.Exit(runConfig(args[1:], cfg, err))
+	}
+	if err != nil {
+		logging.Fatal("Invalid configuration", "error", err)
+	}
+
+	if err = logging.Setup(cfg); err != nil {
+		logging.Fatal("Failed to configure logging", "error", err)
+	}
+
+	shutdownTracing, err := tracing.Setup(cfg)
+	if err != nil {
+		logging.Fatal("Failed to configure tracing", "error", err)
+	}
 
-	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
 		cfg.PgHost,
 		cfg.PgPort,
 		cfg.PgUser,
@@ -37,26 +89,157 @@ func main() {
 
 	db, err := postgres.New(connStr)
 	if err != nil {
-		log.Fatalf("failed to connect database: %v", err)
+		logging.Fatal("Failed to connect database", "error", err)
+	}
+
+	formats, err := token_format.New(cfg, db, db)
+	if err != nil {
+		logging.Fatal("Failed to configure token formats", "error", err)
 	}
 
-	service := jwt_generator.New(db, cfg)
-	app := fiber.New()
-	router.RegisterRoutes(app, service, db, cfg)
+	publisher := outbox.NewPublisher(db, cfg)
+	auditor := audit.New(db)
+	killSwitch := kill_switch.New(db, formats, publisher, auditor)
+	if len(args) > 0 {
+		chainVerifier, err := audit.NewChainVerifier(db, cfg)
+		if err != nil {
+			logging.Fatal("Failed to configure audit verification", "error", err)
+		}
+		code := runCommand(args, killSwitch, chainVerifier)
+		db.Close()
+		_ = shutdownTracing(context.Background())
+		os.Exit(code)
+	}
+
+	sinks, err := sink.FromConfig(cfg)
+	if err != nil {
+		logging.Fatal("Failed to configure audit sinks", "error", err)
+	}
+
+	versions := token_version.New(db)
+	service := jwt_generator.New(db, cfg, formats, publisher, auditor)
+	verifier := jwt_verifier.New(db, formats, versions, killSwitch)
+	sessionService := sessions.New(db, auditor, cfg)
+	oauthService := oauth.New(db, service, verifier, sessionService, cfg)
+	metrics.Registry.MustRegister(metrics.NewPoolCollector(db.Stat))
+	dispatcher := outbox.NewDispatcher(db, cfg)
+	var rateLimits repository.RateLimitRepository = rate_limit.NewMemoryStore()
+	if cfg.RateLimitStore == "postgres" {
+		rateLimits = db
+	}
+	limiter := rate_limit.New(rateLimits, cfg)
+	probes := health.New(
+		health.Postgres(db),
+		health.Migrations(db, postgres.SchemaVersion),
+		health.SigningKey(formats),
+		health.Dispatcher(dispatcher.Check),
+	)
+
+	app := fiber.New(fiber.Config{ErrorHandler: middleware.ErrorHandler})
+	// The probes are registered ahead of the middleware, so they are
+	// neither traced nor counted.
+	app.Get("/healthz", handlers.Healthz(probes))
+	app.Get("/readyz", handlers.Readyz(probes))
+	app.Get("/startupz", handlers.Startupz(probes))
+	app.Use(middleware.RequestID(), middleware.Tracing(), middleware.Metrics())
+	router.RegisterRoutes(app, service, oauthService, sessionService, verifier, versions, killSwitch,
+		outbox.NewAdmin(db, auditor), outbox.NewSubscriptions(db, auditor), publisher, auditor, dpop.New(), db,
+		limiter, formats, cfg)
 	app.Get("/swagger/*", swagger.HandlerDefault)
+	if cfg.MetricsAddr == "" {
+		app.Get("/metrics", metrics.Handler())
+	}
 
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
 
+	listenConfig := fiber.ListenConfig{}
+	if cfg.TLSCertFile != "" {
+		listenConfig.CertFile = cfg.TLSCertFile
+		listenConfig.CertKeyFile = cfg.TLSKeyFile
+		listenConfig.CertClientFile = cfg.TLSClientCAFile
+		listenConfig.TLSConfigFunc = mtls.ClientAuth(cfg.TLSClientAuth)
+	}
+
+	workers := []interface{ Shutdown(context.Context) error }{dispatcher}
+	ctx, cancel := context.WithCancel(context.Background())
+	go config.NewWatcher(cfg, formats, db, publisher, dispatcher, limiter).Run(ctx)
+	go dispatcher.Run(ctx)
+	if cfg.AuditSigningKey != "" {
+		checkpointer, err := audit.NewCheckpointer(db, cfg)
+		if err != nil {
+			logging.Fatal("Failed to configure audit checkpoints", "error", err)
+		}
+		workers = append(workers, checkpointer)
+		go checkpointer.Run(ctx)
+	} else {
+		slog.Warn("AUDIT_SIGNING_KEY is not set, audit log checkpoints are not signed")
+	}
+	for _, s := range sinks {
+		forwarder := sink.NewForwarder(db, s)
+		workers = append(workers, forwarder)
+		go forwarder.Run(ctx)
+	}
+
 	go func() {
-		if err = app.Listen(":8181"); err != nil {
-			log.Fatalf("failed to start server: %v", err)
+		if err := app.Listen(fmt.Sprintf(":%d", cfg.ServerPort), listenConfig); err != nil {
+			logging.Fatal("Failed to start server", "error", err)
 		}
 	}()
 
+	var adminApp *fiber.App
+	if cfg.MetricsAddr != "" {
+		adminApp = fiber.New()
+		adminApp.Get("/metrics", metrics.Handler())
+
+		go func() {
+			if err := adminApp.Listen(cfg.MetricsAddr, fiber.ListenConfig{DisableStartupMessage: true}); err != nil {
+				logging.Fatal("Failed to start admin server", "error", err)
+			}
+		}()
+	}
+
 	<-sig
-	log.Info("Shutting down server...")
+	slog.Info("Shutting down server...")
+
+	// Fail the readiness probe and keep serving until load balancers notice,
+	// then stop accepting connections and drain the requests in flight.
+	probes.Drain()
+	time.Sleep(cfg.ShutdownDelay)
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancelShutdown()
+	if err = app.ShutdownWithContext(shutdownCtx); err != nil {
+		slog.Error("Failed to drain requests", "error", err)
+	}
+
+	// The last requests may have published events and recorded audit
+	// events, the workers flush them while the pool is still open.
+	var wg sync.WaitGroup
+	for _, w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := w.Shutdown(shutdownCtx); err != nil {
+				slog.Error("Failed to stop background worker", "error", err)
+			}
+		}()
+	}
+	wg.Wait()
+	cancel()
+
+	if adminApp != nil {
+		if err = adminApp.ShutdownWithContext(shutdownCtx); err != nil {
+			slog.Error("Failed to stop admin server", "error", err)
+		}
+	}
 	db.Close()
 
-	log.Info("Server stopped gracefully")
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	if err = shutdownTracing(flushCtx); err != nil {
+		slog.Error("Failed to flush traces", "error", err)
+	}
+	cancelFlush()
+
+	slog.Info("Server stopped gracefully")
 }
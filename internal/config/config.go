@@ -1,62 +1,119 @@
 package config
 
 import (
-	"github.com/gofiber/fiber/v3/log"
-	"github.com/joho/godotenv"
-	"os"
+	"time"
 )
 
+// Config is the configuration of the service. Every field is set, from the
+// lowest precedence to the highest, from its default, the config file, the
+// environment variable named by its env tag and the command-line flag named
+// after it. In the config file and in flags the name is the variable's in
+// lower case, with dashes instead of underscores in flags; the file may also
+// group keys by their prefix, so postgres.host is postgres_host.
+//
+// Fields tagged secret are masked when the configuration is printed and can
+// be read from a file instead, named by the same name with a _FILE suffix,
+// such as JWT_SECRET_FILE. Fields tagged reload are switched to without a
+// restart when the configuration is reloaded, see Watcher.
 type Config struct {
-	ServerPort string
-	JWTSecret  string
-	WebhookURL string
-
-	PgHost string
-	PgPort string
-	PgUser string
-	PgPass string
-	PgDB   string
-}
+	ServerPort int    `env:"SERVER_PORT" default:"8181"`
+	JWTSecret  string `env:"JWT_SECRET" secret:"true" reload:"true"`
+	Audience   string `env:"JWT_AUDIENCE" default:"jwt-service"`
+	// WebhookURL is a secret, as receivers often take the URL itself as
+	// proof of the sender.
+	WebhookURL string `env:"WEBHOOK_URL" secret:"true" reload:"true"`
+	// WebhookSecret signs the events sent to WebhookURL. Subscriptions
+	// registered through the admin API have their own secrets.
+	WebhookSecret string `env:"WEBHOOK_SECRET" secret:"true" reload:"true"`
 
-func Load() *Config {
-	if err := godotenv.Load(".env"); err != nil {
-		log.Info("config: .env file not found, reading environment")
-	}
-
-	c := &Config{
-		ServerPort: getEnv("SERVER_PORT", "8080"),
-		JWTSecret:  mustGetEnv("JWT_SECRET", ""),
-		WebhookURL: getEnv("WEBHOOK_URL", ""),
-		PgHost:     mustGetEnv("POSTGRES_HOST", "localhost"),
-		PgPort:     getEnv("POSTGRES_PORT", "5432"),
-		PgUser:     getEnv("POSTGRES_USER", "postgres"),
-		PgPass:     getEnv("POSTGRES_PASSWORD", "mysecretpassword"),
-		PgDB:       getEnv("POSTGRES_DB", "postgres"),
-	}
-
-	if c.JWTSecret == "" {
-		log.Fatal("config: JWT_SECRET must be set")
-	}
-
-	return c
-}
+	AccessTokenFormat string        `env:"ACCESS_TOKEN_FORMAT" default:"jwt" reload:"true"`
+	AccessTokenTTL    time.Duration `env:"ACCESS_TOKEN_TTL" default:"15m"`
+	PasetoSecretKey   string        `env:"PASETO_SECRET_KEY" secret:"true" reload:"true"`
+	PasetoLocalKey    string        `env:"PASETO_LOCAL_KEY" secret:"true" reload:"true"`
+	JWEPrivateKeyFile string        `env:"JWE_PRIVATE_KEY_FILE" reload:"true"`
+	// JWESigningKeyFile signs the JWT inside a JWE, its public key is
+	// published in the JWKS.
+	JWESigningKeyFile string `env:"JWE_SIGNING_KEY_FILE" reload:"true"`
 
-func getEnv(key, defaultVal string) string {
-	if v, ok := os.LookupEnv(key); !ok {
-		return v
-	}
+	PgHost string `env:"POSTGRES_HOST" default:"localhost"`
+	PgPort int    `env:"POSTGRES_PORT" default:"5432"`
+	PgUser string `env:"POSTGRES_USER" default:"postgres" reload:"true"`
+	PgPass string `env:"POSTGRES_PASSWORD" secret:"true" reload:"true"`
+	PgDB   string `env:"POSTGRES_DB" default:"postgres"`
 
-	return defaultVal
-}
+	TLSCertFile     string `env:"TLS_CERT_FILE"`
+	TLSKeyFile      string `env:"TLS_KEY_FILE"`
+	TLSClientCAFile string `env:"TLS_CLIENT_CA_FILE"`
+	TLSClientAuth   string `env:"TLS_CLIENT_AUTH" default:"request"`
+
+	AuthCodeTTL           time.Duration `env:"AUTH_CODE_TTL" default:"1m"`
+	DeviceCodeTTL         time.Duration `env:"DEVICE_CODE_TTL" default:"10m"`
+	DeviceVerificationURI string        `env:"DEVICE_VERIFICATION_URI" default:"http://localhost:8181/api/v1/oauth/device"`
+	// OAuthLoginURL is the login page browsers without a session cookie
+	// are sent to by the authorization and device verification endpoints.
+	OAuthLoginURL      string `env:"OAUTH_LOGIN_URL"`
+	OAuthSessionCookie string `env:"OAUTH_SESSION_COOKIE" default:"oauth_session"`
+
+	// AdminUserIDs are the users given the admin scope, and only in tokens
+	// requested with a client certificate listed in AdminClientCerts, by
+	// its x5t#S256 thumbprint. Without the certificates the admin API is
+	// disabled, as user_id alone proves nothing.
+	AdminUserIDs     []string `env:"ADMIN_USER_IDS"`
+	AdminClientCerts []string `env:"ADMIN_CLIENT_CERTS"`
+
+	// AuditSigningKey signs the audit log checkpoints, which are not
+	// signed without it. AuditVerifyKeys are the public keys of its
+	// previous values, which audit verify checks older checkpoints with.
+	AuditSigningKey string   `env:"AUDIT_SIGNING_KEY" secret:"true"`
+	AuditVerifyKeys []string `env:"AUDIT_VERIFY_KEYS"`
+
+	// Sinks the audit log is forwarded to, each enabled by its address.
+	AuditFilePath       string `env:"AUDIT_FILE_PATH"`
+	AuditFileMaxSizeMB  int    `env:"AUDIT_FILE_MAX_SIZE_MB" default:"100"`
+	AuditFileMaxBackups int    `env:"AUDIT_FILE_MAX_BACKUPS" default:"5"`
+	AuditSyslogAddr     string `env:"AUDIT_SYSLOG_ADDR"` // udp://host:port or tcp://host:port
+	AuditNATSURL        string `env:"AUDIT_NATS_URL"`
+	AuditNATSSubject    string `env:"AUDIT_NATS_SUBJECT" default:"jwt-service.audit"`
+
+	// MetricsAddr is the address of the admin listener serving /metrics.
+	// If empty, /metrics is served by the API listener.
+	MetricsAddr string `env:"METRICS_ADDR"`
+
+	// TracingExporter is none, otlp-grpc, otlp-http or stdout. Without
+	// TracingEndpoint the OTLP exporters read the standard
+	// OTEL_EXPORTER_OTLP_* variables.
+	TracingExporter    string  `env:"TRACING_EXPORTER" default:"none"`
+	TracingEndpoint    string  `env:"TRACING_ENDPOINT"`
+	TracingSampleRatio float64 `env:"TRACING_SAMPLE_RATIO" default:"1"`
+
+	// LogLevel is debug, info, warn or error and LogFormat json or text.
+	LogLevel  string `env:"LOG_LEVEL" default:"info"`
+	LogFormat string `env:"LOG_FORMAT" default:"json"`
+
+	// Requests to the token endpoints are limited per IP, per client and per
+	// user to the given number per RateLimitWindow, 0 lifting a limit. The
+	// limits are kept in memory, for a single instance, or in postgres,
+	// shared by all of them.
+	RateLimitStore     string        `env:"RATE_LIMIT_STORE" default:"memory"`
+	RateLimitWindow    time.Duration `env:"RATE_LIMIT_WINDOW" default:"1m" reload:"true"`
+	RateLimitPerIP     int           `env:"RATE_LIMIT_PER_IP" default:"60" reload:"true"`
+	RateLimitPerClient int           `env:"RATE_LIMIT_PER_CLIENT" default:"300" reload:"true"`
+	RateLimitPerUser   int           `env:"RATE_LIMIT_PER_USER" default:"20" reload:"true"`
+
+	// ShutdownDelay is how long the service keeps serving after it starts
+	// failing its readiness probe, so load balancers stop routing to it
+	// first. ShutdownTimeout then bounds draining requests and flushing
+	// background workers.
+	ShutdownDelay   time.Duration `env:"SHUTDOWN_DELAY" default:"5s"`
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" default:"20s"`
 
-func mustGetEnv(key, defaultVal string) string {
-	if v, ok := os.LookupEnv(key); ok {
-		return v
-	}
-	if defaultVal != "" {
-		return defaultVal
-	}
-	log.Fatalf("config: required environment variable %s is not set", key)
+	// sources records where every field was set from, by key, and
+	// secretFiles the files secrets were read from.
+	sources     map[string]string
+	secretFiles map[string]string
 
-	return ""
+	// args and file are those the configuration was loaded with, to load
+	// it again.
+	args []string
+	file string
 }
@@ -0,0 +1,277 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sources of a configuration value.
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// Load registers the flags of the configuration on fs, parses args with it
+// and layers defaults, the config file, the environment and the flags. The
+// file is named by the -config flag or CONFIG_FILE.
+//
+// Invalid values are reported together in the returned error, along with
+// the config they were found in, so it can still be printed. The config is
+// nil only if args cannot be parsed.
+func Load(fs *flag.FlagSet, args []string) (*Config, error) {
+	if err := godotenv.Load(".env"); err != nil {
+		slog.Info("config: .env file not found, reading environment")
+	}
+
+	c := &Config{
+		sources:     make(map[string]string),
+		secretFiles: make(map[string]string),
+		args:        args,
+	}
+	fields := c.fields()
+
+	file := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML config `file`")
+	flags := make(map[string]string)
+	for _, f := range fields {
+		usage := "overrides " + f.env
+		if f.def != "" {
+			usage += fmt.Sprintf(" (default %s)", f.def)
+		}
+		fs.Func(strings.ReplaceAll(f.key, "_", "-"), usage, func(s string) error {
+			flags[f.key] = s
+			return nil
+		})
+		if f.secret {
+			fs.Func(strings.ReplaceAll(f.key, "_", "-")+"-file", "overrides "+f.env+"_FILE", func(s string) error {
+				flags[f.key+"_file"] = s
+				return nil
+			})
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	c.file = *file
+
+	var errs []error
+	set := func(f field, value, source string) {
+		if err := f.set(value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.env, err))
+			return
+		}
+		c.sources[f.key] = source
+	}
+
+	var fileValues map[string]string
+	if c.file != "" {
+		var err error
+		if fileValues, err = readFile(c.file, fields); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	layers := []struct {
+		source string
+		lookup func(key string) (string, bool)
+	}{
+		{SourceFile, func(key string) (string, bool) {
+			v, ok := fileValues[key]
+			return v, ok
+		}},
+		// An empty variable counts as unset, as compose files often
+		// pass variables through whether they are set or not.
+		{SourceEnv, func(key string) (string, bool) {
+			v := os.Getenv(strings.ToUpper(key))
+			return v, v != ""
+		}},
+		{SourceFlag, func(key string) (string, bool) {
+			v, ok := flags[key]
+			return v, ok
+		}},
+	}
+
+	for _, f := range fields {
+		set(f, f.def, SourceDefault)
+		for _, layer := range layers {
+			value, ok := layer.lookup(f.key)
+			path, fromFile := "", false
+			if f.secret {
+				path, fromFile = layer.lookup(f.key + "_file")
+			}
+
+			switch {
+			case ok && fromFile:
+				errs = append(errs, fmt.Errorf("%s: set either it or %s_FILE in the %s", f.env, f.env, layer.source))
+			case fromFile:
+				data, err := os.ReadFile(path)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s_FILE: %w", f.env, err))
+					continue
+				}
+				// Files written by editors and echo end with a newline
+				// that is not part of the secret.
+				set(f, strings.TrimRight(string(data), "\r\n"), layer.source)
+				c.secretFiles[f.key] = path
+			case ok:
+				set(f, value, layer.source)
+				delete(c.secretFiles, f.key)
+			}
+		}
+	}
+
+	return c, errors.Join(append(errs, c.validate()...)...)
+}
+
+// field is a configurable field of Config.
+type field struct {
+	key    string
+	env    string
+	def    string
+	secret bool
+	reload bool
+	value  reflect.Value
+}
+
+func (c *Config) fields() []field {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+
+	var fields []field
+	for i := range t.NumField() {
+		env := t.Field(i).Tag.Get("env")
+		if env == "" {
+			continue
+		}
+		fields = append(fields, field{
+			key:    strings.ToLower(env),
+			env:    env,
+			def:    t.Field(i).Tag.Get("default"),
+			secret: t.Field(i).Tag.Get("secret") == "true",
+			reload: t.Field(i).Tag.Get("reload") == "true",
+			value:  v.Field(i),
+		})
+	}
+
+	return fields
+}
+
+func (f field) set(s string) error {
+	switch f.value.Interface().(type) {
+	case time.Duration:
+		d, err := time.ParseDuration(s)
+		if s != "" && err != nil {
+			return errors.New("must be a duration, such as 30s or 15m")
+		}
+		f.value.SetInt(int64(d))
+	case []string:
+		f.value.Set(reflect.ValueOf(splitList(s)))
+	case int:
+		n, err := strconv.Atoi(s)
+		if s != "" && err != nil {
+			return errors.New("must be an integer")
+		}
+		f.value.SetInt(int64(n))
+	case float64:
+		x, err := strconv.ParseFloat(s, 64)
+		if s != "" && err != nil {
+			return errors.New("must be a number")
+		}
+		f.value.SetFloat(x)
+	case string:
+		f.value.SetString(s)
+	default:
+		panic("config: unsupported type of " + f.env)
+	}
+
+	return nil
+}
+
+// readFile returns the values of the YAML or TOML config file at path by
+// key, with nested keys joined by underscores.
+func readFile(path string, fields []field) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make(map[string]any)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("%s: unknown format, want .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	flatten("", raw, values)
+
+	known := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		known[f.key] = true
+		if f.secret {
+			known[f.key+"_file"] = true
+		}
+	}
+	var errs []error
+	for key := range values {
+		if !known[key] {
+			errs = append(errs, fmt.Errorf("%s: unknown key %q", path, key))
+		}
+	}
+
+	return values, errors.Join(errs...)
+}
+
+func flatten(prefix string, m map[string]any, values map[string]string) {
+	for k, v := range m {
+		key := strings.ToLower(k)
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+
+		switch v := v.(type) {
+		case map[string]any:
+			flatten(key, v, values)
+		case []any:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			values[key] = strings.Join(items, ",")
+		case nil:
+			values[key] = ""
+		default:
+			values[key] = fmt.Sprint(v)
+		}
+	}
+}
+
+// splitList splits a comma-separated list, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
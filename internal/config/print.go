@@ -0,0 +1,63 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Redacted replaces the values of secrets when the configuration is printed.
+const Redacted = "[REDACTED]"
+
+// Print writes the configuration as a YAML config file, noting where every
+// value was set from. Secrets and the passwords in URLs are masked.
+func (c *Config) Print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	for _, f := range c.fields() {
+		source := c.sources[f.key]
+		if path, ok := c.secretFiles[f.key]; ok {
+			source += ", read from " + path
+		}
+		fmt.Fprintf(tw, "%s: %s\t# %s\n", f.key, f.format(), source)
+	}
+
+	return tw.Flush()
+}
+
+// format returns the value of f as YAML.
+func (f field) format() string {
+	switch v := f.value.Interface().(type) {
+	case string:
+		if f.secret && v != "" {
+			return strconv.Quote(Redacted)
+		}
+		return strconv.Quote(redactURL(v))
+	case time.Duration:
+		return strconv.Quote(v.String())
+	case []string:
+		if f.secret && len(v) > 0 {
+			return "[" + strconv.Quote(Redacted) + "]"
+		}
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = strconv.Quote(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// redactURL masks the password of s if it is a URL with one.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+
+	return u.Redacted()
+}
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"fmt"
+	"jwt-service/internal/services/mtls"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// validate returns an error for every invalid value, so they can all be
+// fixed at once.
+func (c *Config) validate() []error {
+	var errs []error
+	fail := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+	oneOf := func(key, value string, allowed ...string) {
+		if !slices.Contains(allowed, value) {
+			fail(key, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+		}
+	}
+	httpURL := func(key, value string) {
+		if u, err := url.Parse(value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail(key, "must be an http or https URL")
+		}
+	}
+
+	if c.JWTSecret == "" {
+		fail("JWT_SECRET", "must be set")
+	}
+	if c.PgHost == "" {
+		fail("POSTGRES_HOST", "must be set")
+	}
+	if c.ServerPort < 1 || c.ServerPort > 65535 {
+		fail("SERVER_PORT", "must be a port number, got %d", c.ServerPort)
+	}
+	if c.PgPort < 1 || c.PgPort > 65535 {
+		fail("POSTGRES_PORT", "must be a port number, got %d", c.PgPort)
+	}
+
+	oneOf("ACCESS_TOKEN_FORMAT", c.AccessTokenFormat, "jwt", "v4.public", "v4.local", "jwe")
+	if (c.JWEPrivateKeyFile == "") != (c.JWESigningKeyFile == "") {
+		fail("JWE_SIGNING_KEY_FILE", "must be set together with JWE_PRIVATE_KEY_FILE")
+	}
+	positive := func(key string, d time.Duration) {
+		if d <= 0 {
+			fail(key, "must be positive")
+		}
+	}
+	nonNegative := func(key string, n int) {
+		if n < 0 {
+			fail(key, "must not be negative")
+		}
+	}
+	positive("ACCESS_TOKEN_TTL", c.AccessTokenTTL)
+	positive("AUTH_CODE_TTL", c.AuthCodeTTL)
+	positive("DEVICE_CODE_TTL", c.DeviceCodeTTL)
+	positive("SHUTDOWN_TIMEOUT", c.ShutdownTimeout)
+	if c.ShutdownDelay < 0 {
+		fail("SHUTDOWN_DELAY", "must not be negative")
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		fail("TLS_CERT_FILE", "must be set together with TLS_KEY_FILE")
+	}
+	if c.TLSClientCAFile != "" && c.TLSCertFile == "" {
+		fail("TLS_CLIENT_CA_FILE", "requires TLS_CERT_FILE")
+	}
+	oneOf("TLS_CLIENT_AUTH", c.TLSClientAuth, mtls.ClientAuthRequest, mtls.ClientAuthRequire)
+	if len(c.AdminClientCerts) > 0 && c.TLSClientCAFile == "" {
+		fail("ADMIN_CLIENT_CERTS", "requires TLS_CLIENT_CA_FILE")
+	}
+	if len(c.AdminClientCerts) > 0 && len(c.AdminUserIDs) == 0 {
+		fail("ADMIN_USER_IDS", "must be set with ADMIN_CLIENT_CERTS")
+	}
+
+	if c.WebhookURL != "" {
+		httpURL("WEBHOOK_URL", c.WebhookURL)
+	}
+	httpURL("DEVICE_VERIFICATION_URI", c.DeviceVerificationURI)
+	if c.OAuthLoginURL != "" {
+		httpURL("OAUTH_LOGIN_URL", c.OAuthLoginURL)
+	}
+	if c.OAuthSessionCookie == "" {
+		fail("OAUTH_SESSION_COOKIE", "must be set")
+	}
+
+	if c.AuditSyslogAddr != "" {
+		u, err := url.Parse(c.AuditSyslogAddr)
+		if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Host == "" {
+			fail("AUDIT_SYSLOG_ADDR", "must be udp://host:port or tcp://host:port")
+		}
+	}
+	if c.AuditNATSURL != "" && c.AuditNATSSubject == "" {
+		fail("AUDIT_NATS_SUBJECT", "must be set with AUDIT_NATS_URL")
+	}
+	if c.AuditFileMaxSizeMB <= 0 {
+		fail("AUDIT_FILE_MAX_SIZE_MB", "must be positive")
+	}
+	nonNegative("AUDIT_FILE_MAX_BACKUPS", c.AuditFileMaxBackups)
+
+	if c.MetricsAddr != "" {
+		if _, _, err := net.SplitHostPort(c.MetricsAddr); err != nil {
+			fail("METRICS_ADDR", "must be host:port or :port")
+		}
+	}
+
+	oneOf("TRACING_EXPORTER", c.TracingExporter, "none", "otlp-grpc", "otlp-http", "stdout")
+	if c.TracingSampleRatio < 0 || c.TracingSampleRatio > 1 {
+		fail("TRACING_SAMPLE_RATIO", "must be between 0 and 1")
+	}
+
+	oneOf("RATE_LIMIT_STORE", c.RateLimitStore, "memory", "postgres")
+	positive("RATE_LIMIT_WINDOW", c.RateLimitWindow)
+	nonNegative("RATE_LIMIT_PER_IP", c.RateLimitPerIP)
+	nonNegative("RATE_LIMIT_PER_CLIENT", c.RateLimitPerClient)
+	nonNegative("RATE_LIMIT_PER_USER", c.RateLimitPerUser)
+
+	oneOf("LOG_LEVEL", c.LogLevel, "debug", "info", "warn", "error")
+	oneOf("LOG_FORMAT", c.LogFormat, "json", "text")
+
+	return errs
+}
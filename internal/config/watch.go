@@ -0,0 +1,222 @@
+package config
+
+import (
+	"context"
+	"flag"
+	"github.com/fsnotify/fsnotify"
+	"io"
+	"jwt-service/internal/metrics"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// reloadDelay collects the events of a file being rewritten, or of
+	// several secrets being rotated at once, into a single reload.
+	reloadDelay = 500 * time.Millisecond
+	// reloadTimeout bounds the reloaders checking a configuration.
+	reloadTimeout = 10 * time.Second
+)
+
+// Reloader is a component that switches to a reloaded configuration.
+type Reloader interface {
+	// PrepareReload checks that the component can switch to cfg and
+	// returns the function that switches it. A configuration is applied
+	// only once every component has accepted it, so they never run with
+	// different ones.
+	PrepareReload(ctx context.Context, cfg *Config) (apply func(), err error)
+}
+
+// Watcher reloads the configuration on SIGHUP and whenever the config file,
+// a secret file or the JWE key file changes, and switches the reloaders to
+// it. Only fields tagged reload take effect; the others keep the values the
+// service was started with.
+type Watcher struct {
+	started   *Config
+	reloaders []Reloader
+
+	mu      sync.Mutex
+	current *Config
+}
+
+func NewWatcher(cfg *Config, reloaders ...Reloader) *Watcher {
+	return &Watcher{
+		started:   cfg,
+		reloaders: reloaders,
+		current:   cfg,
+	}
+}
+
+// Run reloads the configuration until ctx is done.
+func (w *Watcher) Run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	// Without a file watcher the channels stay nil and never receive.
+	var events <-chan fsnotify.Event
+	var errs <-chan error
+	files, err := fsnotify.NewWatcher()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to watch configuration files, reloading on SIGHUP only", "error", err)
+	} else {
+		defer files.Close()
+		events, errs = files.Events, files.Errors
+		w.watch(ctx, files)
+	}
+
+	timer := time.NewTimer(reloadDelay)
+	timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			timer.Reset(0)
+		case event := <-events:
+			if w.affects(event) {
+				timer.Reset(reloadDelay)
+			}
+		case err = <-errs:
+			slog.WarnContext(ctx, "Failed to watch configuration files", "error", err)
+		case <-timer.C:
+			if err = w.Reload(ctx); err != nil {
+				slog.ErrorContext(ctx, "Failed to reload configuration, keeping the current one", "error", err)
+			} else if files != nil {
+				w.watch(ctx, files)
+			}
+		}
+	}
+}
+
+// Reload loads the configuration again and switches the reloaders to it, or
+// keeps the current one if it is invalid or any of them rejects it.
+func (w *Watcher) Reload(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	err := w.reload(ctx)
+	if err != nil {
+		metrics.ConfigReloads.WithLabelValues("failure").Inc()
+		return err
+	}
+	metrics.ConfigReloads.WithLabelValues("success").Inc()
+
+	return nil
+}
+
+func (w *Watcher) reload(ctx context.Context) error {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	cfg, err := Load(fs, w.started.args)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, reloadTimeout)
+	defer cancel()
+
+	applies := make([]func(), 0, len(w.reloaders))
+	for _, r := range w.reloaders {
+		apply, err := r.PrepareReload(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		applies = append(applies, apply)
+	}
+	for _, apply := range applies {
+		apply()
+	}
+
+	changed, _ := w.current.diff(cfg)
+	_, restart := w.started.diff(cfg)
+	w.current = cfg
+
+	slog.InfoContext(ctx, "Configuration reloaded", "changed", changed)
+	if len(restart) > 0 {
+		slog.WarnContext(ctx, "Configuration changes take effect after a restart", "changed", restart)
+	}
+
+	return nil
+}
+
+// files returns the files the configuration was read from.
+func (c *Config) files() []string {
+	var files []string
+	if c.file != "" {
+		files = append(files, c.file)
+	}
+	for _, path := range c.secretFiles {
+		files = append(files, path)
+	}
+	if c.JWEPrivateKeyFile != "" {
+		files = append(files, c.JWEPrivateKeyFile)
+	}
+	if c.JWESigningKeyFile != "" {
+		files = append(files, c.JWESigningKeyFile)
+	}
+
+	return files
+}
+
+// watch watches the directories of the files of the current configuration.
+// Files are replaced rather than rewritten by most editors and by
+// Kubernetes, which swaps a symlink to the directory holding them, so a
+// watch on the files themselves would be lost after the first change.
+func (w *Watcher) watch(ctx context.Context, files *fsnotify.Watcher) {
+	for _, path := range w.current.files() {
+		dir := filepath.Dir(path)
+		if err := files.Add(dir); err != nil {
+			slog.WarnContext(ctx, "Failed to watch configuration files", "dir", dir, "error", err)
+		}
+	}
+}
+
+// affects reports whether event is a change to one of the files of the
+// current configuration, or to the hidden entries Kubernetes updates them
+// through.
+func (w *Watcher) affects(event fsnotify.Event) bool {
+	if event.Has(fsnotify.Chmod) {
+		return false
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	name := filepath.Clean(event.Name)
+	for _, path := range w.current.files() {
+		if filepath.Clean(path) == name {
+			return true
+		}
+		if filepath.Dir(path) == filepath.Dir(name) && strings.HasPrefix(filepath.Base(name), "..") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// diff returns the names of the fields that differ in other, and of those
+// among them that are not reloaded.
+func (c *Config) diff(other *Config) (changed, restart []string) {
+	fields, others := c.fields(), other.fields()
+	for i, f := range fields {
+		if reflect.DeepEqual(f.value.Interface(), others[i].value.Interface()) {
+			continue
+		}
+		changed = append(changed, f.env)
+		if !f.reload {
+			restart = append(restart, f.env)
+		}
+	}
+
+	return changed, restart
+}
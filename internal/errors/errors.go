@@ -9,10 +9,58 @@ var (
 
 	ErrMissingAuthToken = errors.New("missing auth token")
 	ErrInvalidToken     = errors.New("invalid token")
+	ErrTokenRevoked     = errors.New("token revoked")
 	ErrUserAgentChanged = errors.New("user-agent changed")
 
+	ErrInvalidDPoPProof = errors.New("invalid DPoP proof")
+	ErrDPoPKeyMismatch  = errors.New("DPoP key mismatch")
+	ErrDPoPBoundToken   = errors.New("token is bound to a DPoP key")
+
+	ErrCertificateMismatch = errors.New("client certificate mismatch")
+
 	ErrUnexpectedHashMethod = errors.New("unexpected hash method")
+	ErrUnknownTokenFormat   = errors.New("unknown token format")
+	ErrAudienceKeyNotFound  = errors.New("no encryption key registered for audience")
 	ErrInvalidPayload       = errors.New("invalid payload")
 
+	ErrUserCodeNotFound = errors.New("user code not found or expired")
+
+	ErrSessionNotFound = errors.New("session not found")
+	ErrNoSession       = errors.New("token is not bound to a session")
+	ErrInvalidFilter   = errors.New("invalid filter")
+
+	ErrReasonRequired = errors.New("reason is required")
+	ErrEventNotFound  = errors.New("event not found")
+	ErrMissingScope   = errors.New("insufficient scope")
+
+	ErrInvalidSubscription  = errors.New("invalid subscription")
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+
+	ErrTooManyRequests = errors.New("too many requests")
+
 	ErrInternalServerError = errors.New("internal server error")
 )
+
+// OAuth 2.0 error codes (RFC 6749, section 4.1.2.1 and 5.2).
+var (
+	ErrOAuthInvalidRequest          = errors.New("invalid_request")
+	ErrOAuthInvalidClient           = errors.New("invalid_client")
+	ErrOAuthInvalidGrant            = errors.New("invalid_grant")
+	ErrOAuthUnsupportedGrantType    = errors.New("unsupported_grant_type")
+	ErrOAuthUnsupportedResponseType = errors.New("unsupported_response_type")
+	ErrOAuthUnauthorizedClient      = errors.New("unauthorized_client")
+	ErrOAuthInvalidScope            = errors.New("invalid_scope")
+	ErrOAuthAccessDenied            = errors.New("access_denied")
+	ErrOAuthServerError             = errors.New("server_error")
+
+	// Device authorization grant error codes (RFC 8628, section 3.5).
+	ErrOAuthAuthorizationPending = errors.New("authorization_pending")
+	ErrOAuthSlowDown             = errors.New("slow_down")
+	ErrOAuthExpiredToken         = errors.New("expired_token")
+
+	// Token exchange error codes (RFC 8693, section 2.2.2).
+	ErrOAuthInvalidTarget = errors.New("invalid_target")
+
+	// DPoP error codes (RFC 9449, section 5).
+	ErrOAuthInvalidDPoPProof = errors.New("invalid_dpop_proof")
+)
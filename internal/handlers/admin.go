@@ -0,0 +1,373 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v3"
+	errors2 "jwt-service/internal/errors"
+	"jwt-service/internal/models"
+	"jwt-service/internal/services/audit"
+	kill_switch "jwt-service/internal/services/kill-switch"
+	"jwt-service/internal/services/outbox"
+	"jwt-service/internal/services/sessions"
+	"log/slog"
+	"strconv"
+)
+
+// KillSwitch
+// @Summary     Invalidate all tokens
+// @Description Incident response for a signing key compromise: rejects every access token issued so far, revokes every refresh token and rotates the signing key. Requires the admin scope.
+// @Tags        Admin
+// @Security    BearerAuth
+// @Accept      json
+// @Produce     json
+// @Param       request body     models.KillSwitchRequest true "Reason recorded in the audit trail"
+// @Success     200     {object} models.KillSwitchResponse
+// @Failure     400     {object} models.ErrorResponse
+// @Failure     401     {object} models.ErrorResponse
+// @Failure     403     {object} models.ErrorResponse
+// @Failure     500     {object} models.ErrorResponse
+// @Router      /admin/kill-switch [post]
+// @Example     curl -X POST "http://localhost:8181/api/v1/admin/kill-switch" -H "Authorization: Bearer {admin-access-token}" -d '{"reason":"JWT_SECRET leaked"}'
+func KillSwitch(killSwitch kill_switch.KillSwitch) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		req := models.KillSwitchRequest{}
+		if err := c.Bind().JSON(&req); err != nil {
+			slog.ErrorContext(c.Context(), "Failed to read request body", "error", err)
+
+			return errorJSON(c, fiber.StatusBadRequest, errors2.ErrInvalidPayload.Error())
+		}
+
+		resp, err := killSwitch.Trigger(c.Context(), adminActor(c), req.Reason)
+		if err != nil {
+			if errors.Is(err, errors2.ErrReasonRequired) {
+				return errorJSON(c, fiber.StatusBadRequest, err.Error())
+			}
+			slog.ErrorContext(c.Context(), "Failed to trigger kill switch", "error", err)
+
+			return errorJSON(c, fiber.StatusInternalServerError, errors2.ErrInternalServerError.Error())
+		}
+
+		return c.JSON(resp)
+	}
+}
+
+// adminActor identifies the admin making the request in the audit trail.
+func adminActor(c fiber.Ctx) string {
+	return "user:" + c.Locals("user").(string)
+}
+
+// SearchSessions
+// @Summary     Search sessions
+// @Description Returns active sessions of any user whose current refresh token matches all given criteria. Requires the admin scope.
+// @Tags        Admin
+// @Security    BearerAuth
+// @Produce     json
+// @Param       user_id       query string false "User GUID"
+// @Param       ip            query string false "IP address or CIDR"
+// @Param       user_agent    query string false "User-Agent substring, case-insensitive"
+// @Param       issued_after  query string false "Issued at or after, RFC 3339"
+// @Param       issued_before query string false "Issued before, RFC 3339"
+// @Param       limit         query int    false "Maximum number of sessions (default 100, at most 1000)"
+// @Success     200 {array}  models.SessionResponse
+// @Failure     400 {object} models.ErrorResponse
+// @Failure     401 {object} models.ErrorResponse
+// @Failure     403 {object} models.ErrorResponse
+// @Failure     500 {object} models.ErrorResponse
+// @Router      /admin/sessions [get]
+// @Example     curl -X GET "http://localhost:8181/api/v1/admin/sessions?ip=10.0.0.0/8&user_agent=curl" -H "Authorization: Bearer {admin-access-token}"
+func SearchSessions(service sessions.SessionService) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		req := models.SessionSearchRequest{}
+		if err := c.Bind().Query(&req); err != nil {
+			slog.ErrorContext(c.Context(), "Failed to read query", "error", err)
+
+			return errorJSON(c, fiber.StatusBadRequest, errors2.ErrInvalidPayload.Error())
+		}
+
+		list, err := service.Search(c.Context(), &req)
+		if err != nil {
+			if errors.Is(err, errors2.ErrInvalidFilter) {
+				return errorJSON(c, fiber.StatusBadRequest, err.Error())
+			}
+			slog.ErrorContext(c.Context(), "Failed to search sessions", "error", err)
+
+			return errorJSON(c, fiber.StatusInternalServerError, errors2.ErrInternalServerError.Error())
+		}
+
+		return c.JSON(list)
+	}
+}
+
+// RevokeSessions
+// @Summary     Revoke sessions in bulk
+// @Description Revokes every active session matching all given criteria, at least one is required. The action and its reason are recorded in the audit trail. Requires the admin scope.
+// @Tags        Admin
+// @Security    BearerAuth
+// @Accept      json
+// @Produce     json
+// @Param       request body     models.RevokeSessionsRequest true "Criteria and reason"
+// @Success     200     {object} models.RevokeSessionsResponse
+// @Failure     400     {object} models.ErrorResponse
+// @Failure     401     {object} models.ErrorResponse
+// @Failure     403     {object} models.ErrorResponse
+// @Failure     500     {object} models.ErrorResponse
+// @Router      /admin/sessions/revoke [post]
+// @Example     curl -X POST "http://localhost:8181/api/v1/admin/sessions/revoke" -H "Authorization: Bearer {admin-access-token}" -d '{"user_id":"...","reason":"ticket 1234: lost phone"}'
+func RevokeSessions(service sessions.SessionService) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		req := models.RevokeSessionsRequest{}
+		if err := c.Bind().JSON(&req); err != nil {
+			slog.ErrorContext(c.Context(), "Failed to read request body", "error", err)
+
+			return errorJSON(c, fiber.StatusBadRequest, errors2.ErrInvalidPayload.Error())
+		}
+
+		count, err := service.RevokeMatching(c.Context(), &req, adminActor(c))
+		if err != nil {
+			if errors.Is(err, errors2.ErrInvalidFilter) || errors.Is(err, errors2.ErrReasonRequired) {
+				return errorJSON(c, fiber.StatusBadRequest, err.Error())
+			}
+			slog.ErrorContext(c.Context(), "Failed to revoke sessions", "error", err)
+
+			return errorJSON(c, fiber.StatusInternalServerError, errors2.ErrInternalServerError.Error())
+		}
+
+		return c.JSON(models.RevokeSessionsResponse{Revoked: int(count)})
+	}
+}
+
+// ListOutboxEvents
+// @Summary     List outbox events
+// @Description Returns events of the transactional outbox, newest first. Requires the admin scope.
+// @Tags        Admin
+// @Security    BearerAuth
+// @Produce     json
+// @Param       status query string false "pending, delivered or dead"
+// @Param       limit  query int    false "Maximum number of events (default 100, at most 1000)"
+// @Success     200 {array}  models.OutboxEvent
+// @Failure     400 {object} models.ErrorResponse
+// @Failure     401 {object} models.ErrorResponse
+// @Failure     403 {object} models.ErrorResponse
+// @Failure     500 {object} models.ErrorResponse
+// @Router      /admin/outbox [get]
+// @Example     curl -X GET "http://localhost:8181/api/v1/admin/outbox?status=dead" -H "Authorization: Bearer {admin-access-token}"
+func ListOutboxEvents(service outbox.OutboxAdmin) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		req := models.OutboxListRequest{}
+		if err := c.Bind().Query(&req); err != nil {
+			slog.ErrorContext(c.Context(), "Failed to read query", "error", err)
+
+			return errorJSON(c, fiber.StatusBadRequest, errors2.ErrInvalidPayload.Error())
+		}
+
+		events, err := service.List(c.Context(), req.Status, req.Limit)
+		if err != nil {
+			if errors.Is(err, errors2.ErrInvalidFilter) {
+				return errorJSON(c, fiber.StatusBadRequest, err.Error())
+			}
+			slog.ErrorContext(c.Context(), "Failed to list outbox events", "error", err)
+
+			return errorJSON(c, fiber.StatusInternalServerError, errors2.ErrInternalServerError.Error())
+		}
+
+		return c.JSON(events)
+	}
+}
+
+// RedeliverOutboxEvent
+// @Summary     Redeliver an outbox event
+// @Description Makes an event pending again with a fresh attempt count, typically a dead one. The action is recorded in the audit trail. Requires the admin scope.
+// @Tags        Admin
+// @Security    BearerAuth
+// @Accept      json
+// @Produce     json
+// @Param       id      path int                     true  "Event ID"
+// @Param       request body models.RedeliverRequest false "Reason recorded in the audit trail"
+// @Success     204
+// @Failure     400 {object} models.ErrorResponse
+// @Failure     401 {object} models.ErrorResponse
+// @Failure     403 {object} models.ErrorResponse
+// @Failure     404 {object} models.ErrorResponse
+// @Failure     500 {object} models.ErrorResponse
+// @Router      /admin/outbox/{id}/redeliver [post]
+// @Example     curl -X POST "http://localhost:8181/api/v1/admin/outbox/42/redeliver" -H "Authorization: Bearer {admin-access-token}"
+func RedeliverOutboxEvent(service outbox.OutboxAdmin) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+		if err != nil {
+			return errorJSON(c, fiber.StatusBadRequest, errors2.ErrInvalidPayload.Error())
+		}
+
+		req := models.RedeliverRequest{}
+		if len(c.Body()) > 0 {
+			if err = c.Bind().JSON(&req); err != nil {
+				slog.ErrorContext(c.Context(), "Failed to read request body", "error", err)
+
+				return errorJSON(c, fiber.StatusBadRequest, errors2.ErrInvalidPayload.Error())
+			}
+		}
+
+		err = service.Redeliver(c.Context(), id, adminActor(c), req.Reason)
+		if err != nil {
+			if errors.Is(err, errors2.ErrEventNotFound) {
+				return errorJSON(c, fiber.StatusNotFound, err.Error())
+			}
+			slog.ErrorContext(c.Context(), "Failed to redeliver outbox event", "error", err)
+
+			return errorJSON(c, fiber.StatusInternalServerError, errors2.ErrInternalServerError.Error())
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// ListWebhooks
+// @Summary     List webhook subscriptions
+// @Description Returns the registered webhook endpoints without their secrets. Requires the admin scope.
+// @Tags        Admin
+// @Security    BearerAuth
+// @Produce     json
+// @Success     200 {array}  models.WebhookSubscription
+// @Failure     401 {object} models.ErrorResponse
+// @Failure     403 {object} models.ErrorResponse
+// @Failure     500 {object} models.ErrorResponse
+// @Router      /admin/webhooks [get]
+// @Example     curl -X GET "http://localhost:8181/api/v1/admin/webhooks" -H "Authorization: Bearer {admin-access-token}"
+func ListWebhooks(service outbox.Subscriptions) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		subs, err := service.List(c.Context())
+		if err != nil {
+			slog.ErrorContext(c.Context(), "Failed to list webhook subscriptions", "error", err)
+
+			return errorJSON(c, fiber.StatusInternalServerError, errors2.ErrInternalServerError.Error())
+		}
+
+		return c.JSON(subs)
+	}
+}
+
+// CreateWebhook
+// @Summary     Register a webhook endpoint
+// @Description Subscribes an endpoint to the given event types, or to all of them if none are given. The response holds the secret the deliveries are signed with, it is not shown again. The action is recorded in the audit trail. Requires the admin scope.
+// @Tags        Admin
+// @Security    BearerAuth
+// @Accept      json
+// @Produce     json
+// @Param       request body     models.CreateWebhookRequest true "Endpoint and event types"
+// @Success     201     {object} models.WebhookSubscription
+// @Failure     400     {object} models.ErrorResponse
+// @Failure     401     {object} models.ErrorResponse
+// @Failure     403     {object} models.ErrorResponse
+// @Failure     500     {object} models.ErrorResponse
+// @Router      /admin/webhooks [post]
+// @Example     curl -X POST "http://localhost:8181/api/v1/admin/webhooks" -H "Authorization: Bearer {admin-access-token}" -H "Content-Type: application/json" -d '{"url":"https://siem.example.com/hooks","event_types":["token.reuse_detected","key.rotated"]}'
+func CreateWebhook(service outbox.Subscriptions) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		req := models.CreateWebhookRequest{}
+		if err := c.Bind().JSON(&req); err != nil {
+			slog.ErrorContext(c.Context(), "Failed to read request body", "error", err)
+
+			return errorJSON(c, fiber.StatusBadRequest, errors2.ErrInvalidPayload.Error())
+		}
+
+		sub, err := service.Create(c.Context(), req, adminActor(c))
+		if err != nil {
+			if errors.Is(err, errors2.ErrInvalidSubscription) {
+				return errorJSON(c, fiber.StatusBadRequest, err.Error())
+			}
+			slog.ErrorContext(c.Context(), "Failed to create webhook subscription", "error", err)
+
+			return errorJSON(c, fiber.StatusInternalServerError, errors2.ErrInternalServerError.Error())
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(sub)
+	}
+}
+
+// DeleteWebhook
+// @Summary     Remove a webhook endpoint
+// @Description Deletes a subscription together with its undelivered events. The action is recorded in the audit trail. Requires the admin scope.
+// @Tags        Admin
+// @Security    BearerAuth
+// @Accept      json
+// @Produce     json
+// @Param       id      path string                      true  "Subscription ID"
+// @Param       request body models.DeleteWebhookRequest false "Reason recorded in the audit trail"
+// @Success     204
+// @Failure     400 {object} models.ErrorResponse
+// @Failure     401 {object} models.ErrorResponse
+// @Failure     403 {object} models.ErrorResponse
+// @Failure     404 {object} models.ErrorResponse
+// @Failure     500 {object} models.ErrorResponse
+// @Router      /admin/webhooks/{id} [delete]
+// @Example     curl -X DELETE "http://localhost:8181/api/v1/admin/webhooks/{subscription-id}" -H "Authorization: Bearer {admin-access-token}"
+func DeleteWebhook(service outbox.Subscriptions) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		req := models.DeleteWebhookRequest{}
+		if len(c.Body()) > 0 {
+			if err := c.Bind().JSON(&req); err != nil {
+				slog.ErrorContext(c.Context(), "Failed to read request body", "error", err)
+
+				return errorJSON(c, fiber.StatusBadRequest, errors2.ErrInvalidPayload.Error())
+			}
+		}
+
+		err := service.Delete(c.Context(), c.Params("id"), adminActor(c), req.Reason)
+		if err != nil {
+			if errors.Is(err, errors2.ErrSubscriptionNotFound) {
+				return errorJSON(c, fiber.StatusNotFound, err.Error())
+			}
+			slog.ErrorContext(c.Context(), "Failed to delete webhook subscription", "error", err)
+
+			return errorJSON(c, fiber.StatusInternalServerError, errors2.ErrInternalServerError.Error())
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// ListAuthEvents
+// @Summary     Search the audit log
+// @Description Returns authentication events matching all given criteria, newest first. Pass next_cursor of a page as cursor to get the next one. Requires the admin scope.
+// @Tags        Admin
+// @Security    BearerAuth
+// @Produce     json
+// @Param       event_type query string false "Event type, e.g. token.refreshed"
+// @Param       outcome    query string false "success or failure"
+// @Param       actor      query string false "Actor, e.g. user:{id} or client:{id}"
+// @Param       subject    query string false "User GUID"
+// @Param       client_id  query string false "OAuth client ID"
+// @Param       ip         query string false "Address or CIDR"
+// @Param       since      query string false "Not before, RFC 3339"
+// @Param       until      query string false "Before, RFC 3339"
+// @Param       cursor     query string false "next_cursor of the previous page"
+// @Param       limit      query int    false "Maximum number of events (default 100, at most 1000)"
+// @Success     200 {object} models.AuthEventPage
+// @Failure     400 {object} models.ErrorResponse
+// @Failure     401 {object} models.ErrorResponse
+// @Failure     403 {object} models.ErrorResponse
+// @Failure     500 {object} models.ErrorResponse
+// @Router      /admin/auth-events [get]
+// @Example     curl -X GET "http://localhost:8181/api/v1/admin/auth-events?subject=123e4567-e89b-12d3-a456-426614174000&outcome=failure" -H "Authorization: Bearer {admin-access-token}"
+func ListAuthEvents(service audit.Auditor) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		req := models.AuthEventListRequest{}
+		if err := c.Bind().Query(&req); err != nil {
+			slog.ErrorContext(c.Context(), "Failed to read query", "error", err)
+
+			return errorJSON(c, fiber.StatusBadRequest, errors2.ErrInvalidPayload.Error())
+		}
+
+		page, err := service.List(c.Context(), &req)
+		if err != nil {
+			if errors.Is(err, errors2.ErrInvalidFilter) {
+				return errorJSON(c, fiber.StatusBadRequest, err.Error())
+			}
+			slog.ErrorContext(c.Context(), "Failed to list auth events", "error", err)
+
+			return errorJSON(c, fiber.StatusInternalServerError, errors2.ErrInternalServerError.Error())
+		}
+
+		return c.JSON(page)
+	}
+}
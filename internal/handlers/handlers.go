@@ -1,60 +1,63 @@
 package handlers
 
 import (
-	"context"
 	"errors"
 	"github.com/gofiber/fiber/v3"
-	"github.com/gofiber/fiber/v3/log"
-	"github.com/golang-jwt/jwt/v5"
 	errors2 "jwt-service/internal/errors"
+	"jwt-service/internal/logging"
 	"jwt-service/internal/models"
 	"jwt-service/internal/repository"
+	"jwt-service/internal/services/audit"
+	"jwt-service/internal/services/dpop"
 	jwt_generator "jwt-service/internal/services/jwt-generator"
-	"os"
-)
-
-var (
-	jwtSecret = []byte(os.Getenv("JWT_SECRET"))
+	"jwt-service/internal/services/mtls"
+	"jwt-service/internal/services/outbox"
+	token_version "jwt-service/internal/services/token-version"
+	"log/slog"
 )
 
 // GenerateTokenPair
 // @Summary     Generate access & refresh tokens
-// @Description Issues a new pair of tokens for the given user GUID
+// @Description Issues a new pair of tokens for the given user GUID. With a DPoP proof the pair is bound to its key.
 // @Tags        Auth
 // @Accept      json
 // @Produce     json
-// @Param       user_id query string true "User GUID"
+// @Param       user_id query  string true  "User GUID"
+// @Param       DPoP    header string false "DPoP proof"
 // @Success     200 {object} models.TokenPair
 // @Failure     400 {object} models.ErrorResponse
+// @Failure     429 {object} models.ErrorResponse
 // @Failure     500 {object} models.ErrorResponse
 // @Router      /tokens/generate [post]
 // @Example     curl -X POST "http://localhost:8181/api/v1/tokens/generate?user_id=123e4567-e89b-12d3-a456-426614174000" -H "User-Agent: swagger-client"
-func GenerateTokenPair(service jwt_generator.JWTGenerator) fiber.Handler {
+func GenerateTokenPair(service jwt_generator.JWTGenerator, validator dpop.ProofValidator) fiber.Handler {
 	return func(c fiber.Ctx) error {
-		log.Infof("Auth: %v", c.Get("Authorization"))
-		log.Infof("userID: %v", c.Query("user_id"))
-
 		userID := c.Query("user_id")
 		if userID == "" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Empty user id",
-			})
+			return errorJSON(c, fiber.StatusBadRequest, "Empty user id")
 		}
 		userAgent := c.Get("User-Agent")
 		userInfo := &models.UserInfo{
 			ID:    userID,
 			Agent: userAgent,
 			IP:    c.IP(),
+			X5T:   mtls.CertificateThumbprint(c.RequestCtx().TLSConnectionState()),
 		}
 
-		tokenPair, err := service.GenerateTokenPair(userInfo)
+		jkt, err := dpopThumbprint(c, validator)
 		if err != nil {
-			log.Errorf("Failed to generate token pair: userID: %v, userAgent: %v, error: %v",
-				userID, userAgent, err)
+			slog.ErrorContext(c.Context(), "Failed to validate DPoP proof", "error", err)
 
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": errors2.ErrInternalServerError.Error(),
-			})
+			return errorJSON(c, fiber.StatusBadRequest, errors2.ErrInvalidDPoPProof.Error())
+		}
+		userInfo.JKT = jkt
+
+		tokenPair, err := service.GenerateTokenPair(c.Context(), userInfo)
+		if err != nil {
+			slog.ErrorContext(c.Context(), "Failed to generate token pair", "user_id", userID,
+				"user_agent", userAgent, "error", err)
+
+			return errorJSON(c, fiber.StatusInternalServerError, errors2.ErrInternalServerError.Error())
 		}
 
 		return c.JSON(tokenPair)
@@ -63,13 +66,15 @@ func GenerateTokenPair(service jwt_generator.JWTGenerator) fiber.Handler {
 
 // RefreshTokenPair
 // @Summary     Refresh access & refresh tokens
-// @Description Rotates tokens using the provided old pair
+// @Description Rotates tokens using the provided old pair. A pair bound to a DPoP key requires a proof signed by that key.
 // @Tags        Auth
 // @Accept      json
 // @Produce     json
-// @Param       request body models.TokenPair true "Old token pair"
+// @Param       request body   models.TokenPair true  "Old token pair"
+// @Param       DPoP    header string           false "DPoP proof"
 // @Success     200 {object} models.TokenPair
 // @Failure     400 {object} models.ErrorResponse
+// @Failure     429 {object} models.ErrorResponse
 // @Failure     500 {object} models.ErrorResponse
 // @Router      /tokens/refresh [post]
 // @Example     request body:
@@ -78,38 +83,38 @@ func GenerateTokenPair(service jwt_generator.JWTGenerator) fiber.Handler {
 //	  "access": "eyJhbGciOiJIUzUxMiIsInR5cCI6IkpXVCJ9...",
 //	  "refresh": "c29tZSByZWZyZXNoIHRva2VuIGJhc2U2NA=="
 //	}
-func RefreshTokenPair(service jwt_generator.JWTGenerator) fiber.Handler {
+func RefreshTokenPair(service jwt_generator.JWTGenerator, validator dpop.ProofValidator) fiber.Handler {
 	return func(c fiber.Ctx) error {
 		oldTokenPair := models.TokenPair{}
 		if err := c.Bind().JSON(&oldTokenPair); err != nil {
-			log.Errorf("Failed to read request body: %v", err)
+			slog.ErrorContext(c.Context(), "Failed to read request body", "error", err)
 
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": errors2.ErrInvalidPayload.Error(),
-			})
+			return errorJSON(c, fiber.StatusBadRequest, errors2.ErrInvalidPayload.Error())
 		}
 
 		userInfo := models.UserInfo{
 			Agent: c.Get("User-Agent"),
 			IP:    c.IP(),
+			X5T:   mtls.CertificateThumbprint(c.RequestCtx().TLSConnectionState()),
 		}
 
+		jkt, err := dpopThumbprint(c, validator)
+		if err != nil {
+			slog.ErrorContext(c.Context(), "Failed to validate DPoP proof", "error", err)
+
+			return errorJSON(c, fiber.StatusBadRequest, errors2.ErrInvalidDPoPProof.Error())
+		}
+		userInfo.JKT = jkt
+
 		newTokenPair, err := service.RefreshTokenPair(c.Context(), &oldTokenPair, &userInfo)
 		if err != nil {
-			log.Errorf("Failed to refresh token pair: %v", err)
+			slog.ErrorContext(c.Context(), "Failed to refresh token pair", "error", err)
 
 			switch {
 			case errors.Is(err, errors2.ErrInternalServerError):
-				return c.Status(fiber.StatusInternalServerError).JSON(
-					fiber.Map{
-						"error": errors2.ErrInternalServerError.Error(),
-					})
+				return errorJSON(c, fiber.StatusInternalServerError, errors2.ErrInternalServerError.Error())
 			default:
-				return c.Status(fiber.StatusBadRequest).JSON(
-					fiber.Map{
-						"error": err.Error(),
-					})
-
+				return errorJSON(c, fiber.StatusBadRequest, err.Error())
 			}
 		}
 
@@ -136,7 +141,7 @@ func Whoami(c fiber.Ctx) error {
 
 // Logout
 // @Summary     Logout user and revoke tokens
-// @Description Adds the current access token to blacklist and revokes all refresh tokens
+// @Description Adds the current access token to blacklist, revokes all refresh tokens and invalidates all other access tokens of the user
 // @Tags        Logout
 // @Security    BearerAuth
 // @Produce     json
@@ -144,51 +149,97 @@ func Whoami(c fiber.Ctx) error {
 // @Failure     500 {object} models.ErrorResponse
 // @Router      /logout [post]
 // @Example     curl -X POST "http://localhost:8181/api/v1/logout" -H "Authorization: Bearer {your-access-token}"
-func Logout(repo repository.JWTRepository) fiber.Handler {
+func Logout(repo repository.JWTRepository, versions token_version.TokenVersions,
+	publisher outbox.Publisher, auditor audit.Auditor) fiber.Handler {
 	return func(c fiber.Ctx) error {
-		auth := c.Get("Authorization")
-		tokenStr := auth[len("Bearer "):]
-		token, _ := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-			return jwtSecret, nil
-		})
+		claims := c.Locals("claims").(*models.AccessClaims)
+		jti := claims.ID
+		userID := claims.Subject
+		ctx := c.Context()
 
-		claims := token.Claims.(jwt.MapClaims)
-		jti := claims["jti"].(string)
-		userID := claims["sub"].(string)
-
-		tx, err := repo.BeginTx()
+		tx, err := repo.BeginTx(ctx)
 		if err != nil {
-			log.Errorf("failed to start tx")
+			slog.ErrorContext(ctx, "failed to start tx")
 			return err
 		}
-		defer tx.Rollback(context.Background())
+		defer tx.Rollback(ctx)
+
+		err = repo.BlacklistJWTTx(ctx, tx, jti)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to add JWT at blacklist", "error", err)
+
+			return errorJSON(c, fiber.StatusInternalServerError, errors2.ErrInternalServerError.Error())
+		}
 
-		err = repo.BlacklistJWTTx(tx, jti)
+		err = repo.RevokeAllRefreshTx(ctx, tx, userID)
 		if err != nil {
-			log.Errorf("Failed to add JWT at blacklist: %v", err)
+			slog.ErrorContext(ctx, "Failed to revoke all refreshs", "error", err)
 
-			return c.Status(fiber.StatusInternalServerError).JSON(
-				fiber.Map{
-					"error": errors2.ErrInternalServerError.Error(),
-				})
+			return errorJSON(c, fiber.StatusInternalServerError, errors2.ErrInternalServerError.Error())
 		}
 
-		err = repo.RevokeAllRefreshTx(tx, userID)
+		err = publisher.PublishTx(ctx, tx, outbox.EventLogout, userID, map[string]string{
+			"user_id":    userID,
+			"session_id": claims.SessionID,
+			"ip":         c.IP(),
+			"user_agent": c.Get("User-Agent"),
+		})
 		if err != nil {
-			log.Errorf("Failed to revoke all refreshs: %v", err)
+			slog.ErrorContext(ctx, "Failed to publish event", "error", err)
 
-			return c.Status(fiber.StatusInternalServerError).JSON(
-				fiber.Map{
-					"error": errors2.ErrInternalServerError.Error(),
-				})
+			return errorJSON(c, fiber.StatusInternalServerError, errors2.ErrInternalServerError.Error())
 		}
 
-		if err = tx.Commit(context.Background()); err != nil {
-			log.Errorf("Tx commit failed: %v", err)
+		err = auditor.RecordTx(ctx, tx, models.AuthEvent{
+			EventType: audit.EventLogout,
+			Outcome:   models.OutcomeSuccess,
+			Actor:     audit.UserActor(userID, claims.ClientID),
+			Subject:   userID,
+			ClientID:  claims.ClientID,
+			SessionID: claims.SessionID,
+			IP:        c.IP(),
+			UserAgent: c.Get("User-Agent"),
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to record audit event", "error", err)
+
+			return errorJSON(c, fiber.StatusInternalServerError, errors2.ErrInternalServerError.Error())
+		}
+
+		if err = tx.Commit(ctx); err != nil {
+			slog.ErrorContext(ctx, "Tx commit failed", "error", err)
 
 			return err
 		}
 
+		// Access tokens issued to the user's other devices are not in the
+		// blacklist, bumping the version invalidates them all.
+		if _, err = versions.Bump(ctx, userID); err != nil {
+			slog.ErrorContext(ctx, "Failed to bump token version", "error", err)
+
+			return errorJSON(c, fiber.StatusInternalServerError, errors2.ErrInternalServerError.Error())
+		}
+
 		return c.SendStatus(fiber.StatusNoContent)
 	}
 }
+
+// dpopThumbprint validates the DPoP proof sent to a token endpoint, if any,
+// and returns the thumbprint of its key.
+func dpopThumbprint(c fiber.Ctx, validator dpop.ProofValidator) (string, error) {
+	proof := c.Get(dpop.HeaderName)
+	if proof == "" {
+		return "", nil
+	}
+
+	return validator.Validate(proof, c.Method(), c.BaseURL()+c.Path(), "")
+}
+
+// errorJSON responds with status and an error message tagged with the ID of
+// the request.
+func errorJSON(c fiber.Ctx, status int, msg string) error {
+	return c.Status(status).JSON(models.ErrorResponse{
+		Error:     msg,
+		RequestID: logging.RequestID(c.Context()),
+	})
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"context"
+	"github.com/gofiber/fiber/v3"
+	"jwt-service/internal/models"
+	"jwt-service/internal/services/health"
+)
+
+// Healthz is the liveness probe.
+func Healthz(h health.Health) fiber.Handler {
+	return probe(h.Live)
+}
+
+// Readyz is the readiness probe, it fails while a dependency is unavailable
+// and once the service starts draining.
+func Readyz(h health.Health) fiber.Handler {
+	return probe(h.Ready)
+}
+
+// Startupz is the startup probe.
+func Startupz(h health.Health) fiber.Handler {
+	return probe(h.Started)
+}
+
+// probe responds with the report of check, with status 503 if it failed.
+func probe(check func(ctx context.Context) models.HealthReport) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		report := check(c.Context())
+		if report.Status != health.StatusOK {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(report)
+		}
+
+		return c.JSON(report)
+	}
+}
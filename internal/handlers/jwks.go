@@ -0,0 +1,15 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v3"
+	token_format "jwt-service/internal/services/token-format"
+)
+
+// JWKS serves the public keys the tokens of the service can be verified
+// with (RFC 7517), so that audiences of jwe tokens can check their
+// signature. HS512 and PASETO keys are never published.
+func JWKS(formats *token_format.Formats) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		return c.JSON(formats.JWKS(), "application/jwk-set+json")
+	}
+}
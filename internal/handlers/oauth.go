@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/gofiber/fiber/v3"
+	"jwt-service/internal/config"
+	errors2 "jwt-service/internal/errors"
+	"jwt-service/internal/logging"
+	"jwt-service/internal/models"
+	"jwt-service/internal/services/dpop"
+	"jwt-service/internal/services/mtls"
+	"jwt-service/internal/services/oauth"
+	"log/slog"
+	"net/url"
+	"strings"
+)
+
+// Authorize
+// @Summary     OAuth 2.0 authorization endpoint
+// @Description Issues an authorization code for the authenticated user (authorization code grant with PKCE, S256 only) and redirects back to the client.
+// @Description Browsers are authenticated by the session cookie set by POST /oauth/session, without it they are redirected to OAUTH_LOGIN_URL if it is set.
+// @Tags        OAuth
+// @Security    BearerAuth
+// @Param       response_type         query string true  "Must be \"code\""
+// @Param       client_id             query string true  "Registered client ID"
+// @Param       redirect_uri          query string false "Registered redirect URI"
+// @Param       state                 query string false "Opaque value returned to the client"
+// @Param       code_challenge        query string true  "BASE64URL(SHA256(code_verifier))"
+// @Param       code_challenge_method query string true  "Must be \"S256\""
+// @Success     302
+// @Failure     400 {object} models.OAuthErrorResponse
+// @Failure     401 {object} models.ErrorResponse
+// @Router      /oauth/authorize [get]
+func Authorize(service oauth.OAuthService) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		req := models.AuthorizeRequest{}
+		if err := c.Bind().Query(&req); err != nil {
+			slog.ErrorContext(c.Context(), "Failed to read authorize request", "error", err)
+
+			return oauthError(c, errors2.ErrOAuthInvalidRequest)
+		}
+
+		location, err := service.Authorize(c.Context(), &req, c.Locals("user").(string))
+		if err != nil {
+			return oauthError(c, err)
+		}
+
+		return c.Redirect().Status(fiber.StatusFound).To(location)
+	}
+}
+
+// Token
+// @Summary     OAuth 2.0 token endpoint
+// @Description Exchanges an authorization code and its PKCE verifier, or an approved device code, for an access/refresh token pair.
+// @Description With the token exchange grant, issues an audience-restricted access token for the subject of another token.
+// @Description Confidential clients authenticate with HTTP Basic or client_secret.
+// @Tags        OAuth
+// @Accept      x-www-form-urlencoded
+// @Produce     json
+// @Param       grant_type           formData string true  "\"authorization_code\", \"urn:ietf:params:oauth:grant-type:device_code\" or \"urn:ietf:params:oauth:grant-type:token-exchange\""
+// @Param       client_id            formData string true  "Client ID"
+// @Param       client_secret        formData string false "Client secret"
+// @Param       code                 formData string false "Authorization code"
+// @Param       redirect_uri         formData string false "Redirect URI used in the authorization request"
+// @Param       code_verifier        formData string false "PKCE code verifier"
+// @Param       device_code          formData string false "Device code"
+// @Param       subject_token        formData string false "Token to exchange"
+// @Param       subject_token_type   formData string false "\"urn:ietf:params:oauth:token-type:access_token\""
+// @Param       actor_token          formData string false "Token of the acting party"
+// @Param       actor_token_type     formData string false "\"urn:ietf:params:oauth:token-type:access_token\""
+// @Param       audience             formData string false "Audience of the exchanged token"
+// @Param       scope                formData string false "Space-separated scopes of the exchanged token"
+// @Param       requested_token_type formData string false "\"urn:ietf:params:oauth:token-type:access_token\""
+// @Param       DPoP                 header   string false "DPoP proof, binds the issued tokens to its key"
+// @Success     200 {object} models.OAuthTokenResponse
+// @Failure     400 {object} models.OAuthErrorResponse
+// @Failure     429 {object} models.ErrorResponse
+// @Failure     500 {object} models.OAuthErrorResponse
+// @Router      /oauth/token [post]
+func Token(service oauth.OAuthService, validator dpop.ProofValidator) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		req := models.TokenRequest{}
+		if err := c.Bind().Form(&req); err != nil {
+			slog.ErrorContext(c.Context(), "Failed to read token request", "error", err)
+
+			return oauthError(c, errors2.ErrOAuthInvalidRequest)
+		}
+
+		userInfo := models.UserInfo{
+			Agent: c.Get("User-Agent"),
+			IP:    c.IP(),
+			X5T:   mtls.CertificateThumbprint(c.RequestCtx().TLSConnectionState()),
+		}
+
+		jkt, err := dpopThumbprint(c, validator)
+		if err != nil {
+			slog.ErrorContext(c.Context(), "Failed to validate DPoP proof", "error", err)
+
+			return oauthError(c, errors2.ErrOAuthInvalidDPoPProof)
+		}
+		userInfo.JKT = jkt
+
+		if clientID, clientSecret, ok := basicAuth(c); ok {
+			req.ClientID, req.ClientSecret = clientID, clientSecret
+		}
+
+		resp, err := service.Token(c.Context(), &req, &userInfo)
+		if err != nil {
+			// Devices poll until the user approves, pending polls are not failures.
+			if !errors.Is(err, errors2.ErrOAuthAuthorizationPending) && !errors.Is(err, errors2.ErrOAuthSlowDown) {
+				slog.ErrorContext(c.Context(), "Failed to issue oauth token", "error", err)
+			}
+
+			return oauthError(c, err)
+		}
+
+		c.Set(fiber.HeaderCacheControl, "no-store")
+		c.Set(fiber.HeaderPragma, "no-cache")
+
+		return c.JSON(resp)
+	}
+}
+
+// DeviceAuthorization
+// @Summary     OAuth 2.0 device authorization endpoint
+// @Description Starts a device authorization grant: returns a device code to poll the token endpoint with and a user code to enter on the verification page
+// @Tags        OAuth
+// @Accept      x-www-form-urlencoded
+// @Produce     json
+// @Param       client_id formData string true "Client ID"
+// @Success     200 {object} models.DeviceAuthorizationResponse
+// @Failure     400 {object} models.OAuthErrorResponse
+// @Failure     401 {object} models.OAuthErrorResponse
+// @Router      /oauth/device_authorization [post]
+func DeviceAuthorization(service oauth.OAuthService) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		req := models.DeviceAuthorizationRequest{}
+		if err := c.Bind().Form(&req); err != nil {
+			slog.ErrorContext(c.Context(), "Failed to read device authorization request", "error", err)
+
+			return oauthError(c, errors2.ErrOAuthInvalidRequest)
+		}
+
+		resp, err := service.DeviceAuthorization(c.Context(), &req)
+		if err != nil {
+			return oauthError(c, err)
+		}
+
+		c.Set(fiber.HeaderCacheControl, "no-store")
+
+		return c.JSON(resp)
+	}
+}
+
+// DeviceVerification
+// @Summary     Get a pending device authorization
+// @Description Returns the client that requested the device authorization, so the user can confirm it on the verification page
+// @Tags        OAuth
+// @Security    BearerAuth
+// @Produce     json
+// @Param       user_code query string true "User code displayed on the device"
+// @Success     200 {object} models.DeviceVerificationResponse
+// @Failure     401 {object} models.ErrorResponse
+// @Failure     404 {object} models.ErrorResponse
+// @Router      /oauth/device [get]
+func DeviceVerification(service oauth.OAuthService) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		resp, err := service.GetDeviceVerification(c.Context(), c.Query("user_code"))
+		if err != nil {
+			return deviceVerificationError(c, err)
+		}
+
+		return c.JSON(resp)
+	}
+}
+
+// VerifyDevice
+// @Summary     Approve or deny a device authorization
+// @Description Approves or denies the device authorization identified by the user code on behalf of the current user
+// @Tags        OAuth
+// @Security    BearerAuth
+// @Accept      json
+// @Produce     json
+// @Param       request body models.DeviceVerificationRequest true "User code and decision"
+// @Success     204
+// @Failure     400 {object} models.ErrorResponse
+// @Failure     401 {object} models.ErrorResponse
+// @Failure     404 {object} models.ErrorResponse
+// @Router      /oauth/device [post]
+func VerifyDevice(service oauth.OAuthService) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		req := models.DeviceVerificationRequest{}
+		if err := c.Bind().JSON(&req); err != nil {
+			slog.ErrorContext(c.Context(), "Failed to read request body", "error", err)
+
+			return errorJSON(c, fiber.StatusBadRequest, errors2.ErrInvalidPayload.Error())
+		}
+
+		if err := service.VerifyDevice(c.Context(), &req, c.Locals("user").(string)); err != nil {
+			return deviceVerificationError(c, err)
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// oauthCookiePath scopes the session cookie to the OAuth endpoints.
+const oauthCookiePath = "/api/v1/oauth"
+
+// CreateOAuthSession
+// @Summary     Start a browser session for the OAuth front channel
+// @Description Stores the access token of the request in an HttpOnly cookie, which authenticates the browser on the authorization and device verification pages. Called by the login page with credentials included. DPoP-bound tokens cannot be stored.
+// @Tags        OAuth
+// @Security    BearerAuth
+// @Success     204
+// @Failure     400 {object} models.ErrorResponse
+// @Failure     401 {object} models.ErrorResponse
+// @Router      /oauth/session [post]
+func CreateOAuthSession(cfg *config.Config) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		// The cookie is sent without a proof, it would strip the binding.
+		claims := c.Locals("claims").(*models.AccessClaims)
+		if claims.Cnf != nil && claims.Cnf.JKT != "" {
+			return errorJSON(c, fiber.StatusBadRequest, errors2.ErrDPoPBoundToken.Error())
+		}
+
+		_, tokenStr, _ := strings.Cut(c.Get("Authorization"), " ")
+		c.Cookie(&fiber.Cookie{
+			Name:     cfg.OAuthSessionCookie,
+			Value:    tokenStr,
+			Path:     oauthCookiePath,
+			Expires:  claims.ExpiresAt.Time,
+			Secure:   true,
+			HTTPOnly: true,
+			// Lax, so that the cookie is sent on the redirect of the client
+			// to the authorization endpoint but not with cross-site posts.
+			SameSite: fiber.CookieSameSiteLaxMode,
+		})
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// DeleteOAuthSession
+// @Summary     End the browser session of the OAuth front channel
+// @Description Clears the session cookie. The access token it held stays valid until it expires or the user logs out.
+// @Tags        OAuth
+// @Success     204
+// @Router      /oauth/session [delete]
+func DeleteOAuthSession(cfg *config.Config) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		c.Cookie(&fiber.Cookie{
+			Name:     cfg.OAuthSessionCookie,
+			Path:     oauthCookiePath,
+			MaxAge:   -1,
+			Secure:   true,
+			HTTPOnly: true,
+			SameSite: fiber.CookieSameSiteLaxMode,
+		})
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+func deviceVerificationError(c fiber.Ctx, err error) error {
+	if errors.Is(err, errors2.ErrUserCodeNotFound) {
+		return errorJSON(c, fiber.StatusNotFound, err.Error())
+	}
+
+	return errorJSON(c, fiber.StatusInternalServerError, errors2.ErrInternalServerError.Error())
+}
+
+// basicAuth extracts client credentials sent with HTTP Basic authentication
+// (RFC 6749, section 2.3.1).
+func basicAuth(c fiber.Ctx) (string, string, bool) {
+	encoded, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Basic ")
+	if !ok {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", false
+	}
+	rawID, rawSecret, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", "", false
+	}
+
+	clientID, err := url.QueryUnescape(rawID)
+	if err != nil {
+		return "", "", false
+	}
+	clientSecret, err := url.QueryUnescape(rawSecret)
+	if err != nil {
+		return "", "", false
+	}
+
+	return clientID, clientSecret, true
+}
+
+// oauthError renders err as an RFC 6749 error response. Errors produced by the
+// oauth service wrap one of the OAuth error codes and add a description.
+func oauthError(c fiber.Ctx, err error) error {
+	codes := []struct {
+		err    error
+		status int
+	}{
+		{errors2.ErrOAuthInvalidRequest, fiber.StatusBadRequest},
+		{errors2.ErrOAuthInvalidClient, fiber.StatusUnauthorized},
+		{errors2.ErrOAuthInvalidGrant, fiber.StatusBadRequest},
+		{errors2.ErrOAuthUnsupportedGrantType, fiber.StatusBadRequest},
+		{errors2.ErrOAuthUnsupportedResponseType, fiber.StatusBadRequest},
+		{errors2.ErrOAuthUnauthorizedClient, fiber.StatusBadRequest},
+		{errors2.ErrOAuthInvalidScope, fiber.StatusBadRequest},
+		{errors2.ErrOAuthInvalidTarget, fiber.StatusBadRequest},
+		{errors2.ErrOAuthInvalidDPoPProof, fiber.StatusBadRequest},
+		{errors2.ErrOAuthAccessDenied, fiber.StatusBadRequest},
+		{errors2.ErrOAuthAuthorizationPending, fiber.StatusBadRequest},
+		{errors2.ErrOAuthSlowDown, fiber.StatusBadRequest},
+		{errors2.ErrOAuthExpiredToken, fiber.StatusBadRequest},
+	}
+
+	for _, code := range codes {
+		if errors.Is(err, code.err) {
+			return c.Status(code.status).JSON(models.OAuthErrorResponse{
+				Error:            code.err.Error(),
+				ErrorDescription: strings.TrimPrefix(strings.TrimPrefix(err.Error(), code.err.Error()), ": "),
+				RequestID:        logging.RequestID(c.Context()),
+			})
+		}
+	}
+
+	return c.Status(fiber.StatusInternalServerError).JSON(models.OAuthErrorResponse{
+		Error:     errors2.ErrOAuthServerError.Error(),
+		RequestID: logging.RequestID(c.Context()),
+	})
+}
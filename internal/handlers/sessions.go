@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v3"
+	errors2 "jwt-service/internal/errors"
+	"jwt-service/internal/models"
+	"jwt-service/internal/services/sessions"
+	"log/slog"
+)
+
+// ListSessions
+// @Summary     List active sessions
+// @Description Returns the caller's sessions that have not been revoked, with the device they were used from
+// @Tags        Sessions
+// @Security    BearerAuth
+// @Produce     json
+// @Success     200 {array}  models.SessionResponse
+// @Failure     401 {object} models.ErrorResponse
+// @Failure     500 {object} models.ErrorResponse
+// @Router      /sessions [get]
+// @Example     curl -X GET "http://localhost:8181/api/v1/sessions" -H "Authorization: Bearer {your-access-token}"
+func ListSessions(service sessions.SessionService) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		claims := c.Locals("claims").(*models.AccessClaims)
+
+		list, err := service.List(c.Context(), claims.Subject, claims.SessionID)
+		if err != nil {
+			slog.ErrorContext(c.Context(), "Failed to list sessions", "user_id", claims.Subject, "error", err)
+
+			return errorJSON(c, fiber.StatusInternalServerError, errors2.ErrInternalServerError.Error())
+		}
+
+		return c.JSON(list)
+	}
+}
+
+// RevokeSession
+// @Summary     Sign out of a session
+// @Description Revokes the refresh tokens of one of the caller's sessions and blacklists its access tokens
+// @Tags        Sessions
+// @Security    BearerAuth
+// @Produce     json
+// @Param       id path string true "Session ID"
+// @Success     204
+// @Failure     401 {object} models.ErrorResponse
+// @Failure     404 {object} models.ErrorResponse
+// @Failure     500 {object} models.ErrorResponse
+// @Router      /sessions/{id} [delete]
+// @Example     curl -X DELETE "http://localhost:8181/api/v1/sessions/{session-id}" -H "Authorization: Bearer {your-access-token}"
+func RevokeSession(service sessions.SessionService) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		claims := c.Locals("claims").(*models.AccessClaims)
+
+		err := service.Revoke(c.Context(), claims.Subject, c.Params("id"), c.IP(), c.Get("User-Agent"))
+		if err != nil {
+			if errors.Is(err, errors2.ErrSessionNotFound) {
+				return errorJSON(c, fiber.StatusNotFound, err.Error())
+			}
+			slog.ErrorContext(c.Context(), "Failed to revoke session", "user_id", claims.Subject, "error", err)
+
+			return errorJSON(c, fiber.StatusInternalServerError, errors2.ErrInternalServerError.Error())
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// RevokeOtherSessions
+// @Summary     Sign out of all other sessions
+// @Description Revokes every session of the caller except the one the access token belongs to
+// @Tags        Sessions
+// @Security    BearerAuth
+// @Produce     json
+// @Success     200 {object} models.RevokeSessionsResponse
+// @Failure     400 {object} models.ErrorResponse
+// @Failure     401 {object} models.ErrorResponse
+// @Failure     500 {object} models.ErrorResponse
+// @Router      /sessions/revoke-others [post]
+// @Example     curl -X POST "http://localhost:8181/api/v1/sessions/revoke-others" -H "Authorization: Bearer {your-access-token}"
+func RevokeOtherSessions(service sessions.SessionService) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		claims := c.Locals("claims").(*models.AccessClaims)
+
+		count, err := service.RevokeOthers(c.Context(), claims.Subject, claims.SessionID, c.IP(), c.Get("User-Agent"))
+		if err != nil {
+			if errors.Is(err, errors2.ErrNoSession) {
+				return errorJSON(c, fiber.StatusBadRequest, err.Error())
+			}
+			slog.ErrorContext(c.Context(), "Failed to revoke other sessions", "user_id", claims.Subject, "error", err)
+
+			return errorJSON(c, fiber.StatusInternalServerError, errors2.ErrInternalServerError.Error())
+		}
+
+		return c.JSON(models.RevokeSessionsResponse{Revoked: count})
+	}
+}
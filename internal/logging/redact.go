@@ -0,0 +1,83 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are the attribute keys whose values are never logged. Keys
+// ending in _token, _secret, _hash or _password are redacted as well.
+var sensitiveKeys = map[string]bool{
+	"authorization": true,
+	"cookie":        true,
+	"token":         true,
+	"access":        true,
+	"refresh":       true,
+	"secret":        true,
+	"password":      true,
+	"hash":          true,
+	"code":          true,
+	"code_verifier": true,
+	"device_code":   true,
+	"dpop":          true,
+}
+
+var sensitiveSuffixes = []string{"_token", "_secret", "_hash", "_password"}
+
+// authorization matches the credentials of an Authorization header.
+var authorization = regexp.MustCompile(`(?i)\b(Bearer|DPoP|Basic)\s+[A-Za-z0-9._~+/=-]+`)
+
+// sensitivePatterns match secrets that end up in free text, such as error
+// messages: JWS and JWE compact serializations, PASETO tokens and bcrypt
+// hashes.
+var sensitivePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`eyJ[A-Za-z0-9_-]*(\.[A-Za-z0-9_-]*){2,4}`),
+	regexp.MustCompile(`v[1-4]\.(local|public)\.[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)?`),
+	regexp.MustCompile(`\$2[abxy]?\$\d{2}\$[./A-Za-z0-9]{53}`),
+}
+
+// Redact replaces the secrets found in s.
+func Redact(s string) string {
+	s = authorization.ReplaceAllString(s, "$1 "+redacted)
+	for _, p := range sensitivePatterns {
+		s = p.ReplaceAllLiteralString(s, redacted)
+	}
+
+	return s
+}
+
+// redactAttr hides the values of sensitive keys and the secrets found in
+// strings and errors.
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	if sensitiveKey(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Redact(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, Redact(err.Error()))
+		}
+	}
+
+	return a
+}
+
+func sensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	if sensitiveKeys[key] {
+		return true
+	}
+	for _, suffix := range sensitiveSuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
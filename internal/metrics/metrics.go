@@ -0,0 +1,145 @@
+package metrics
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	errors2 "jwt-service/internal/errors"
+	"strings"
+	"time"
+)
+
+const namespace = "jwt_service"
+
+// Registry holds the metrics of the service, along with the Go runtime and
+// process ones.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	TokensIssued = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tokens_issued_total",
+		Help:      "Token pairs and standalone access tokens issued.",
+	})
+	TokensRefreshed = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tokens_refreshed_total",
+		Help:      "Token pairs refreshed.",
+	})
+	TokensRejected = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tokens_rejected_total",
+		Help:      "Access and refresh tokens rejected, by token type and reason.",
+	}, []string{"token", "reason"})
+
+	BcryptDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "bcrypt_duration_seconds",
+		Help:      "Duration of bcrypt hashing and comparisons.",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1},
+	}, []string{"op"})
+	DBQueryDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Duration of database queries, by statement and outcome.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"statement", "outcome"})
+	HTTPRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of HTTP requests, by method, route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	WebhookDeliveries = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Webhook delivery attempts, by outcome: delivered, failed or dead.",
+	}, []string{"outcome"})
+
+	BlacklistLookups = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "blacklist_lookups_total",
+		Help:      "Access token blacklist lookups, by result: hit or miss.",
+	}, []string{"result"})
+
+	RateLimited = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Requests rejected by a rate limit, by scope: ip, client or user.",
+	}, []string{"scope"})
+
+	ConfigReloads = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "config_reloads_total",
+		Help:      "Configuration reloads, by outcome: success or failure.",
+	}, []string{"outcome"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+}
+
+// ObserveBcrypt records the duration of a bcrypt operation started at start,
+// it is meant to be deferred.
+func ObserveBcrypt(op string, start time.Time) {
+	BcryptDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+}
+
+// Rejected counts a rejected token of the given type, access or refresh.
+func Rejected(token string, err error) {
+	TokensRejected.WithLabelValues(token, Reason(err)).Inc()
+}
+
+// reasons are the errors that label rejections, any other error is counted
+// as an internal one.
+var reasons = []error{
+	errors2.ErrMissingAuthToken,
+	errors2.ErrInvalidToken,
+	errors2.ErrInvalidAccessToken,
+	errors2.ErrInvalidRefreshToken,
+	errors2.ErrRefreshNotFoundOrRevoked,
+	errors2.ErrTokenRevoked,
+	errors2.ErrUserAgentChanged,
+	errors2.ErrInvalidDPoPProof,
+	errors2.ErrDPoPKeyMismatch,
+	errors2.ErrDPoPBoundToken,
+	errors2.ErrCertificateMismatch,
+}
+
+// Reason returns the label of err, its message in snake case.
+func Reason(err error) string {
+	for _, reason := range reasons {
+		if errors.Is(err, reason) {
+			return label(reason.Error())
+		}
+	}
+
+	return label(errors2.ErrInternalServerError.Error())
+}
+
+func label(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			return r
+		}
+		if r >= 'A' && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return '_'
+	}, s)
+}
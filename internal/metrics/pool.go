@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PoolCollector reports the statistics of a pgxpool connection pool when
+// metrics are scraped.
+type PoolCollector struct {
+	stat func() *pgxpool.Stat
+
+	acquiredConns       *prometheus.Desc
+	idleConns           *prometheus.Desc
+	constructingConns   *prometheus.Desc
+	totalConns          *prometheus.Desc
+	maxConns            *prometheus.Desc
+	acquires            *prometheus.Desc
+	acquireDuration     *prometheus.Desc
+	emptyAcquires       *prometheus.Desc
+	canceledAcquires    *prometheus.Desc
+	newConns            *prometheus.Desc
+	maxLifetimeDestroys *prometheus.Desc
+	maxIdleTimeDestroys *prometheus.Desc
+}
+
+func NewPoolCollector(stat func() *pgxpool.Stat) *PoolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", name), help, nil, nil)
+	}
+
+	return &PoolCollector{
+		stat:                stat,
+		acquiredConns:       desc("acquired_conns", "Connections currently acquired from the pool."),
+		idleConns:           desc("idle_conns", "Idle connections in the pool."),
+		constructingConns:   desc("constructing_conns", "Connections being established."),
+		totalConns:          desc("total_conns", "Connections in the pool."),
+		maxConns:            desc("max_conns", "Maximum size of the pool."),
+		acquires:            desc("acquires_total", "Successful acquires from the pool."),
+		acquireDuration:     desc("acquire_duration_seconds_total", "Time spent in successful acquires."),
+		emptyAcquires:       desc("empty_acquires_total", "Acquires that had to wait for a connection."),
+		canceledAcquires:    desc("canceled_acquires_total", "Acquires canceled by their context."),
+		newConns:            desc("new_conns_total", "Connections opened."),
+		maxLifetimeDestroys: desc("max_lifetime_destroys_total", "Connections closed for exceeding their maximum lifetime."),
+		maxIdleTimeDestroys: desc("max_idle_time_destroys_total", "Connections closed for exceeding their maximum idle time."),
+	}
+}
+
+func (p *PoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(p, ch)
+}
+
+func (p *PoolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := p.stat()
+
+	gauge := func(desc *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v)
+	}
+	counter := func(desc *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, v)
+	}
+
+	gauge(p.acquiredConns, float64(s.AcquiredConns()))
+	gauge(p.idleConns, float64(s.IdleConns()))
+	gauge(p.constructingConns, float64(s.ConstructingConns()))
+	gauge(p.totalConns, float64(s.TotalConns()))
+	gauge(p.maxConns, float64(s.MaxConns()))
+	counter(p.acquires, float64(s.AcquireCount()))
+	counter(p.acquireDuration, s.AcquireDuration().Seconds())
+	counter(p.emptyAcquires, float64(s.EmptyAcquireCount()))
+	counter(p.canceledAcquires, float64(s.CanceledAcquireCount()))
+	counter(p.newConns, float64(s.NewConnsCount()))
+	counter(p.maxLifetimeDestroys, float64(s.MaxLifetimeDestroyCount()))
+	counter(p.maxIdleTimeDestroys, float64(s.MaxIdleDestroyCount()))
+}
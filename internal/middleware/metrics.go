@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v3"
+	"jwt-service/internal/metrics"
+	"strconv"
+	"time"
+)
+
+// Metrics records the duration of requests in the http_request_duration_seconds
+// histogram, labelled by the route pattern rather than the path so ids in
+// paths do not create new series.
+func Metrics() fiber.Handler {
+	return func(c fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = errorStatus(err)
+		}
+
+		metrics.HTTPRequestDuration.WithLabelValues(c.Method(), c.Route().Path, strconv.Itoa(status)).
+			Observe(time.Since(start).Seconds())
+
+		return err
+	}
+}
+
+// errorStatus returns the status the error handler will respond to err with,
+// it has not been set yet when the middleware sees the error.
+func errorStatus(err error) int {
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return fiberErr.Code
+	}
+
+	return fiber.StatusInternalServerError
+}
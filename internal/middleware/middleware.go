@@ -1,46 +1,172 @@
 package middleware
 
 import (
+	"errors"
 	"github.com/gofiber/fiber/v3"
-	"github.com/gofiber/fiber/v3/log"
-	"github.com/golang-jwt/jwt/v5"
 	"jwt-service/internal/config"
 	errors2 "jwt-service/internal/errors"
-	"jwt-service/internal/repository"
+	"jwt-service/internal/logging"
+	"jwt-service/internal/metrics"
+	"jwt-service/internal/models"
+	"jwt-service/internal/services/dpop"
+	jwt_verifier "jwt-service/internal/services/jwt-verifier"
+	"jwt-service/internal/services/mtls"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
 )
 
-func AuthMiddleware(repo repository.JWTRepository, cfg *config.Config) fiber.Handler {
+// AuthMiddleware authenticates requests with a Bearer or DPoP access token.
+// Tokens restricted to an audience are accepted only if it includes
+// cfg.Audience, DPoP-bound tokens only with a proof signed by their key and
+// certificate-bound tokens only over a connection with that certificate.
+// The subject is stored in the "user" local and the claims in "claims".
+func AuthMiddleware(verifier jwt_verifier.JWTVerifier, validator dpop.ProofValidator, cfg *config.Config) fiber.Handler {
 	return func(c fiber.Ctx) error {
-		auth := c.Get("Authorization")
-		if auth == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": errors2.ErrMissingAuthToken,
-			})
+		scheme, tokenStr, _ := strings.Cut(c.Get("Authorization"), " ")
+		if (scheme != "Bearer" && scheme != dpop.TokenType) || tokenStr == "" {
+			return unauthorized(c, errors2.ErrMissingAuthToken)
 		}
 
-		tokenStr := auth[len("Bearer "):]
-		token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-			if token.Method != jwt.SigningMethodHS512 {
-				return nil, errors2.ErrUnexpectedHashMethod
-			}
-			return cfg.JWTSecret, nil
-		})
-		if err != nil || !token.Valid {
-			return errors2.ErrInvalidToken
+		claims, err := authenticate(c, verifier, validator, cfg, scheme, tokenStr)
+		if errors.Is(err, errors2.ErrInternalServerError) {
+			return errorJSON(c, fiber.StatusInternalServerError, errors2.ErrInternalServerError.Error())
 		}
-		claims := token.Claims.(jwt.MapClaims)
-		jti := claims["jti"].(string)
+		if err != nil {
+			return unauthorized(c, err)
+		}
+
+		c.Locals("user", claims.Subject)
+		c.Locals("claims", claims)
+
+		return c.Next()
+	}
+}
 
-		exist, err := repo.IsJWTBlacklisted(jti)
-		if err != nil || exist {
-			log.Errorf("err: %v; exist: %v", err, exist)
+// FrontChannelAuth authenticates the browser requests of the OAuth front
+// channel, which cannot carry an Authorization header, with the access
+// token stored in the cfg.OAuthSessionCookie cookie by POST /oauth/session.
+// The token is checked as a bearer token, so DPoP-bound tokens are
+// refused. Without a usable cookie the browser is sent to cfg.OAuthLoginURL
+// with the URL of the request in return_to, if it is set. Requests with an
+// Authorization header are authenticated by AuthMiddleware.
+func FrontChannelAuth(verifier jwt_verifier.JWTVerifier, validator dpop.ProofValidator,
+	cfg *config.Config) fiber.Handler {
+	auth := AuthMiddleware(verifier, validator, cfg)
 
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "token revoked",
-			})
+	return func(c fiber.Ctx) error {
+		if c.Get("Authorization") != "" {
+			return auth(c)
+		}
+
+		tokenStr := c.Cookies(cfg.OAuthSessionCookie)
+		if tokenStr == "" {
+			return login(c, cfg, errors2.ErrMissingAuthToken)
+		}
+
+		claims, err := authenticate(c, verifier, validator, cfg, "Bearer", tokenStr)
+		if errors.Is(err, errors2.ErrInternalServerError) {
+			return errorJSON(c, fiber.StatusInternalServerError, errors2.ErrInternalServerError.Error())
+		}
+		if err != nil {
+			return login(c, cfg, err)
 		}
 
-		c.Locals("user", claims["sub"].(string))
+		c.Locals("user", claims.Subject)
+		c.Locals("claims", claims)
+
+		return c.Next()
+	}
+}
+
+// authenticate checks an access token presented with scheme. It returns
+// errors2.ErrInternalServerError if the token could not be checked.
+func authenticate(c fiber.Ctx, verifier jwt_verifier.JWTVerifier, validator dpop.ProofValidator,
+	cfg *config.Config, scheme, tokenStr string) (*models.AccessClaims, error) {
+	claims, err := verifier.Verify(c.Context(), tokenStr)
+	if err != nil {
+		slog.ErrorContext(c.Context(), "Failed to verify access token", "error", err)
+
+		return nil, err
+	}
+
+	if len(claims.Audience) > 0 && !slices.Contains(claims.Audience, cfg.Audience) {
+		return nil, errors2.ErrInvalidToken
+	}
+
+	boundJKT := ""
+	if claims.Cnf != nil {
+		boundJKT = claims.Cnf.JKT
+	}
+
+	switch {
+	case scheme == dpop.TokenType:
+		jkt, err := validator.Validate(c.Get(dpop.HeaderName), c.Method(), c.BaseURL()+c.Path(), tokenStr)
+		if err != nil {
+			slog.ErrorContext(c.Context(), "Failed to validate DPoP proof", "error", err)
+
+			c.Set(fiber.HeaderWWWAuthenticate, `DPoP error="invalid_dpop_proof"`)
+			return nil, errors2.ErrInvalidDPoPProof
+		}
+		if boundJKT == "" || jkt != boundJKT {
+			return nil, errors2.ErrDPoPKeyMismatch
+		}
+	case boundJKT != "":
+		// A DPoP-bound token presented as a bearer token (RFC 9449, section 7.1).
+		c.Set(fiber.HeaderWWWAuthenticate, `DPoP error="invalid_token"`)
+		return nil, errors2.ErrDPoPBoundToken
+	}
+
+	if claims.Cnf != nil && claims.Cnf.X5TS256 != "" &&
+		mtls.CertificateThumbprint(c.RequestCtx().TLSConnectionState()) != claims.Cnf.X5TS256 {
+		return nil, errors2.ErrCertificateMismatch
+	}
+
+	return claims, nil
+}
+
+// login sends a browser without a usable session cookie to the login page,
+// or rejects the request with err if there is none.
+func login(c fiber.Ctx, cfg *config.Config, err error) error {
+	if cfg.OAuthLoginURL == "" {
+		return unauthorized(c, err)
+	}
+	metrics.Rejected("access", err)
+
+	// OAUTH_LOGIN_URL is validated on load.
+	u, _ := url.Parse(cfg.OAuthLoginURL)
+	query := u.Query()
+	query.Set("return_to", c.BaseURL()+c.OriginalURL())
+	u.RawQuery = query.Encode()
+
+	return c.Redirect().Status(fiber.StatusSeeOther).To(u.String())
+}
+
+// unauthorized rejects a request with an unusable access token.
+func unauthorized(c fiber.Ctx, err error) error {
+	metrics.Rejected("access", err)
+
+	return errorJSON(c, fiber.StatusUnauthorized, err.Error())
+}
+
+// errorJSON responds with status and an error message tagged with the ID of
+// the request.
+func errorJSON(c fiber.Ctx, status int, msg string) error {
+	return c.Status(status).JSON(models.ErrorResponse{
+		Error:     msg,
+		RequestID: logging.RequestID(c.Context()),
+	})
+}
+
+// RequireScope rejects requests whose access token lacks scope. It must run
+// after AuthMiddleware.
+func RequireScope(scope string) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		claims, ok := c.Locals("claims").(*models.AccessClaims)
+		if !ok || !slices.Contains(strings.Fields(claims.Scope), scope) {
+			return errorJSON(c, fiber.StatusForbidden, errors2.ErrMissingScope.Error())
+		}
 
 		return c.Next()
 	}
@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/gofiber/fiber/v3"
+	errors2 "jwt-service/internal/errors"
+	"jwt-service/internal/metrics"
+	"jwt-service/internal/models"
+	"jwt-service/internal/services/mtls"
+	rate_limit "jwt-service/internal/services/rate-limit"
+	token_format "jwt-service/internal/services/token-format"
+	"log/slog"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Identify returns the client and the user a request is made by or for,
+// either empty if it is not known before the request is handled.
+type Identify func(c fiber.Ctx) (client, user string)
+
+// RateLimit rejects requests over the limit of their IP, client or user
+// with 429 Too Many Requests and Retry-After. The RateLimit-* headers
+// (draft-ietf-httpapi-ratelimit-headers) describe the limit closest to
+// being reached. If the limits cannot be checked, requests are let through.
+func RateLimit(limiter rate_limit.Limiter, identify Identify) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		client, user := identify(c)
+
+		var closest rate_limit.Result
+		for _, key := range []struct{ scope, id string }{
+			{rate_limit.ScopeIP, c.IP()},
+			{rate_limit.ScopeClient, client},
+			{rate_limit.ScopeUser, user},
+		} {
+			if key.id == "" {
+				continue
+			}
+
+			result, err := limiter.Allow(c.Context(), key.scope, key.id)
+			if err != nil {
+				slog.ErrorContext(c.Context(), "Failed to check rate limit", "scope", key.scope, "error", err)
+				continue
+			}
+			if result.Limit == 0 {
+				continue
+			}
+
+			if !result.Allowed() {
+				metrics.RateLimited.WithLabelValues(key.scope).Inc()
+				setRateLimitHeaders(c, result)
+				c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds(result.RetryAfter)))
+
+				return errorJSON(c, fiber.StatusTooManyRequests, errors2.ErrTooManyRequests.Error())
+			}
+			if closest.Limit == 0 || result.Remaining < closest.Remaining {
+				closest = result
+			}
+		}
+
+		if closest.Limit > 0 {
+			setRateLimitHeaders(c, closest)
+		}
+
+		return c.Next()
+	}
+}
+
+func setRateLimitHeaders(c fiber.Ctx, result rate_limit.Result) {
+	c.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Set("RateLimit-Reset", strconv.Itoa(seconds(result.Reset)))
+	c.Set("RateLimit-Policy", strconv.Itoa(result.Limit)+";w="+strconv.Itoa(seconds(result.Window)))
+}
+
+// seconds rounds d up to whole seconds, so clients do not retry too early.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// QueryUser identifies the user by the user_id query parameter and the
+// client by its TLS certificate.
+func QueryUser(c fiber.Ctx) (string, string) {
+	return certificateClient(c), c.Query("user_id")
+}
+
+// TokenPairUser identifies the user by the subject of the access token of
+// the pair in the body, and the client by the client the token was issued
+// to or its TLS certificate. The token is authenticated first, so requests
+// cannot be counted against someone else's limit.
+func TokenPairUser(formats *token_format.Formats) Identify {
+	return func(c fiber.Ctx) (string, string) {
+		var pair models.TokenPair
+		if err := json.Unmarshal(c.Body(), &pair); err != nil {
+			return certificateClient(c), ""
+		}
+		claims, err := formats.Parse(pair.Access)
+		if err != nil {
+			return certificateClient(c), ""
+		}
+		if claims.ClientID != "" {
+			return claims.ClientID, claims.Subject
+		}
+
+		return certificateClient(c), claims.Subject
+	}
+}
+
+// OAuthClient identifies the client by the client_id of the form or of
+// HTTP Basic authentication. It is not authenticated yet, so requests
+// naming a client count against its limit whether they come from it or not.
+func OAuthClient(c fiber.Ctx) (string, string) {
+	if clientID := c.FormValue("client_id"); clientID != "" {
+		return clientID, ""
+	}
+
+	encoded, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Basic ")
+	if !ok {
+		return "", ""
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ""
+	}
+	rawID, _, _ := strings.Cut(string(decoded), ":")
+	clientID, err := url.QueryUnescape(rawID)
+	if err != nil {
+		return "", ""
+	}
+
+	return clientID, ""
+}
+
+// certificateClient identifies a client by the thumbprint of its TLS
+// certificate, empty without one.
+func certificateClient(c fiber.Ctx) string {
+	thumbprint := mtls.CertificateThumbprint(c.RequestCtx().TLSConnectionState())
+	if thumbprint == "" {
+		return ""
+	}
+
+	return "x5t:" + thumbprint
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	errors2 "jwt-service/internal/errors"
+	"jwt-service/internal/logging"
+	"log/slog"
+	"regexp"
+)
+
+// requestIDPattern restricts the request IDs accepted from callers, so they
+// cannot forge log lines.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID tags every request with the ID sent by the caller in
+// X-Request-ID, or a new one, and echoes it in the response. Log lines,
+// audit events and error responses reach it through c.Context().
+func RequestID() fiber.Handler {
+	return func(c fiber.Ctx) error {
+		id := c.Get(fiber.HeaderXRequestID)
+		if !requestIDPattern.MatchString(id) {
+			id = uuid.NewString()
+		}
+		c.Set(fiber.HeaderXRequestID, id)
+		c.SetContext(logging.WithRequestID(c.Context(), id))
+
+		return c.Next()
+	}
+}
+
+// ErrorHandler responds to the errors returned by handlers with an error
+// response tagged with the request ID. Errors other than *fiber.Error are
+// logged and reported as internal ones, so their details do not leak.
+func ErrorHandler(c fiber.Ctx, err error) error {
+	msg := errors2.ErrInternalServerError.Error()
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		msg = fiberErr.Message
+	} else {
+		slog.ErrorContext(c.Context(), "Unhandled error", "error", err)
+	}
+
+	return errorJSON(c, errorStatus(err), msg)
+}
@@ -0,0 +1,34 @@
+package models
+
+import "github.com/golang-jwt/jwt/v5"
+
+// AccessClaims are the claims carried by access tokens.
+type AccessClaims struct {
+	jwt.RegisteredClaims
+
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	// SessionID identifies the login session the token was issued in. It is
+	// kept across refreshes.
+	SessionID string `json:"sid,omitempty"`
+	// Version is the user's token version at issue time. Tokens with an
+	// older version than the current one are rejected.
+	Version int64 `json:"ver,omitempty"`
+	// Act is set on tokens obtained through token exchange and records the
+	// delegation chain (RFC 8693, section 4.1).
+	Act *Actor `json:"act,omitempty"`
+	// Cnf binds the token to a proof-of-possession key (RFC 7800).
+	Cnf *Confirmation `json:"cnf,omitempty"`
+}
+
+type Confirmation struct {
+	// JKT is the JWK SHA-256 thumbprint of the DPoP key (RFC 9449).
+	JKT string `json:"jkt,omitempty"`
+	// X5TS256 is the SHA-256 thumbprint of the client certificate (RFC 8705).
+	X5TS256 string `json:"x5t#S256,omitempty"`
+}
+
+type Actor struct {
+	Subject string `json:"sub"`
+	Act     *Actor `json:"act,omitempty"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// AdminAction is an entry of the audit trail of administrative actions.
+type AdminAction struct {
+	ID        int64
+	Action    string
+	Actor     string // "user:<id>" for the admin API, "cli:<os user>" for commands
+	Reason    string
+	Details   []byte // JSON object
+	CreatedAt time.Time
+}
@@ -0,0 +1,56 @@
+package models
+
+type KillSwitchRequest struct {
+	Reason string `json:"reason"`
+}
+
+// SessionSearchRequest holds the criteria of the admin session search. ip
+// is an address or a CIDR, times are RFC 3339.
+type SessionSearchRequest struct {
+	UserID       string `query:"user_id" json:"user_id"`
+	IP           string `query:"ip" json:"ip"`
+	UserAgent    string `query:"user_agent" json:"user_agent"`
+	IssuedAfter  string `query:"issued_after" json:"issued_after"`
+	IssuedBefore string `query:"issued_before" json:"issued_before"`
+	Limit        int    `query:"limit" json:"-"`
+}
+
+type RevokeSessionsRequest struct {
+	SessionSearchRequest
+	Reason string `json:"reason"`
+}
+
+type OutboxListRequest struct {
+	Status string `query:"status"`
+	Limit  int    `query:"limit"`
+}
+
+type RedeliverRequest struct {
+	Reason string `json:"reason"`
+}
+
+type CreateWebhookRequest struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Reason     string   `json:"reason"`
+}
+
+type DeleteWebhookRequest struct {
+	Reason string `json:"reason"`
+}
+
+// AuthEventListRequest holds the criteria of the audit log listing. ip is an
+// address or a CIDR, times are RFC 3339 and cursor is the next_cursor of the
+// previous page.
+type AuthEventListRequest struct {
+	EventType string `query:"event_type"`
+	Outcome   string `query:"outcome"`
+	Actor     string `query:"actor"`
+	Subject   string `query:"subject"`
+	ClientID  string `query:"client_id"`
+	IP        string `query:"ip"`
+	Since     string `query:"since"`
+	Until     string `query:"until"`
+	Cursor    string `query:"cursor"`
+	Limit     int    `query:"limit"`
+}
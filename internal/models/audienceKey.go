@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// AudienceKey is the public key access tokens for an audience are encrypted to.
+type AudienceKey struct {
+	Audience  string
+	JWK       []byte // public key as a JSON Web Key
+	CreatedAt time.Time
+}
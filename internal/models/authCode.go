@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+type AuthCode struct {
+	CodeHash string
+	ClientID string
+	UserID   string
+	// RedirectURI is the one sent in the authorization request, empty if it
+	// was omitted.
+	RedirectURI   string
+	CodeChallenge string
+	ExpiresAt     time.Time
+	Used          bool
+	// SessionID is the session of the tokens issued for the code.
+	SessionID string
+}
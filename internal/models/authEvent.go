@@ -0,0 +1,58 @@
+package models
+
+import (
+	"net/netip"
+	"time"
+)
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// AuthEvent is an entry of the append-only audit log of authentication
+// events. Entries form a hash chain: Seq numbers them without gaps and Hash
+// covers the entry and the Hash of the previous one.
+type AuthEvent struct {
+	ID        int64     `json:"id"`
+	Seq       int64     `json:"seq"`
+	EventType string    `json:"event_type"`
+	Outcome   string    `json:"outcome"`
+	Actor     string    `json:"actor"` // "user:<id>", "client:<id>", "cli:<os user>" or "anonymous"
+	Subject   string    `json:"subject,omitempty"`
+	ClientID  string    `json:"client_id,omitempty"`
+	SessionID string    `json:"session_id,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	PrevHash  []byte    `json:"-"`
+	Hash      []byte    `json:"-"`
+}
+
+// AuditCheckpoint is an Ed25519 signature over the head of the audit log hash
+// chain. KID is the RFC 7638 thumbprint of the AUDIT_SIGNING_KEY it was
+// signed with.
+type AuditCheckpoint struct {
+	Seq       int64
+	Hash      []byte
+	KID       string
+	Signature []byte
+	CreatedAt time.Time
+}
+
+// AuthEventFilter selects audit log entries. Empty criteria match
+// everything.
+type AuthEventFilter struct {
+	EventType string
+	Outcome   string
+	Actor     string
+	Subject   string
+	ClientID  string
+	IP        *netip.Prefix
+	Since     *time.Time
+	Until     *time.Time
+	// BeforeID continues a listing after the entry with this ID.
+	BeforeID int64
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+const (
+	DeviceCodePending  = "pending"
+	DeviceCodeApproved = "approved"
+	DeviceCodeDenied   = "denied"
+	DeviceCodeConsumed = "consumed"
+)
+
+type DeviceCode struct {
+	DeviceCodeHash string
+	UserCode       string
+	ClientID       string
+	UserID         string
+	Status         string
+	Interval       int
+	ExpiresAt      time.Time
+	LastPolledAt   *time.Time
+}
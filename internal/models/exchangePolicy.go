@@ -0,0 +1,9 @@
+package models
+
+type ExchangePolicy struct {
+	ClientID      string
+	Audience      string
+	Scopes        []string
+	MaxTTLSeconds int
+	ActorRequired bool
+}
@@ -0,0 +1,14 @@
+package models
+
+// HealthReport is the response of the health probes: the overall status,
+// ok or fail, and the result of every check.
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+type CheckResult struct {
+	Status     string  `json:"status"`
+	Error      string  `json:"error,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "net/netip"
+
+// ParseIPPrefix parses the ip criterion of the session and audit log
+// filters, an address or a CIDR. A single address is a /32 or /128 prefix.
+func ParseIPPrefix(s string) (netip.Prefix, error) {
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		addr, addrErr := netip.ParseAddr(s)
+		if addrErr != nil {
+			return netip.Prefix{}, addrErr
+		}
+		prefix = netip.PrefixFrom(addr, addr.BitLen())
+	}
+
+	return prefix.Masked(), nil
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+type OAuthClient struct {
+	ID           string
+	Name         string
+	SecretHash   string // bcrypt, empty for public clients
+	RedirectURIs []string
+	TokenFormat  string // access token format, empty for the service default
+	CreatedAt    time.Time
+}
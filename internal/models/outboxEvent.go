@@ -0,0 +1,32 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	OutboxPending   = "pending"
+	OutboxDelivered = "delivered"
+	OutboxDead      = "dead"
+)
+
+// OutboxEvent is an event waiting for, or done with, delivery to Target.
+// It is written in the same transaction as the change it reports.
+type OutboxEvent struct {
+	ID        int64  `json:"id"`
+	EventType string `json:"event_type"`
+	Target    string `json:"target"`
+	// SubscriptionID is empty for events to WEBHOOK_URL.
+	SubscriptionID string          `json:"subscription_id,omitempty"`
+	Payload        json.RawMessage `json:"payload" swaggertype:"object"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	// TraceContext holds the W3C trace context of the request that caused
+	// the event, so its delivery joins the same trace.
+	TraceContext map[string]string `json:"-"`
+}
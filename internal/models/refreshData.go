@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"log/slog"
+	"time"
+)
 
 type RefreshData struct {
 	UserID    string
@@ -10,4 +13,18 @@ type RefreshData struct {
 	Revoked   bool
 	JTI       string
 	IssuedAt  time.Time
+	JKT       string
+	X5T       string
+	SessionID string
+}
+
+// LogValue logs the record without the hash of the refresh token.
+func (r RefreshData) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("user_id", r.UserID),
+		slog.String("session_id", r.SessionID),
+		slog.String("jti", r.JTI),
+		slog.Bool("revoked", r.Revoked),
+		slog.Time("issued_at", r.IssuedAt),
+	)
 }
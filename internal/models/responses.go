@@ -1,9 +1,76 @@
 package models
 
+import "time"
+
 type UserResponse struct {
 	UserID string `json:"user_id"`
 }
 
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Error     string `json:"error"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+type OAuthTokenResponse struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int64  `json:"expires_in"`
+	RefreshToken    string `json:"refresh_token,omitempty"`
+	Scope           string `json:"scope,omitempty"`
+}
+
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+	RequestID        string `json:"request_id,omitempty"`
+}
+
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+type DeviceVerificationResponse struct {
+	UserCode   string    `json:"user_code"`
+	ClientID   string    `json:"client_id"`
+	ClientName string    `json:"client_name"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"user_id,omitempty"` // set in admin responses only
+	DeviceType string    `json:"device_type"`
+	Device     string    `json:"device,omitempty"`
+	OS         string    `json:"os,omitempty"`
+	Browser    string    `json:"browser,omitempty"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	FirstSeen  time.Time `json:"first_seen"`
+	LastUsed   time.Time `json:"last_used"`
+	Current    bool      `json:"current"`
+}
+
+type RevokeSessionsResponse struct {
+	Revoked int `json:"revoked"`
+}
+
+type KillSwitchResponse struct {
+	NotBefore            time.Time `json:"not_before"`
+	RevokedRefreshTokens int64     `json:"revoked_refresh_tokens"`
+	KeyID                string    `json:"key_id"`
+	// RotateManually lists the configured keys the kill switch cannot
+	// rotate, which can still issue tokens until they are replaced.
+	RotateManually []string `json:"rotate_manually,omitempty"`
+}
+
+type AuthEventPage struct {
+	Events []AuthEvent `json:"events"`
+	// NextCursor fetches the next page, it is empty on the last one.
+	NextCursor string `json:"next_cursor,omitempty"`
 }
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Session is a login session: the chain of refresh tokens issued since the
+// user logged in, identified by the session_id they share.
+type Session struct {
+	ID        string
+	UserID    string
+	UserAgent string // of the most recent refresh token
+	IP        string // of the most recent refresh token
+	FirstSeen time.Time
+	LastUsed  time.Time
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"net/netip"
+	"time"
+)
+
+// SessionFilter selects sessions by their current refresh token. Empty
+// criteria match everything.
+type SessionFilter struct {
+	UserID       string
+	IP           *netip.Prefix // a single address is a /32 or /128 prefix
+	UserAgent    string        // case-insensitive substring
+	IssuedAfter  *time.Time
+	IssuedBefore *time.Time
+}
+
+func (f SessionFilter) IsEmpty() bool {
+	return f.UserID == "" && f.IP == nil && f.UserAgent == "" && f.IssuedAfter == nil && f.IssuedBefore == nil
+}
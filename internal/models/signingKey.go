@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// SigningKey is an HS512 key of the access token keyring. Only the newest
+// key signs, retired keys no longer verify.
+type SigningKey struct {
+	KID       string
+	Secret    []byte
+	CreatedAt time.Time
+}
@@ -1,6 +1,13 @@
 package models
 
+import "log/slog"
+
 type TokenPair struct {
 	Access  string `json:"access"`
 	Refresh string `json:"refresh"`
 }
+
+// LogValue keeps the tokens out of logs.
+func (t TokenPair) LogValue() slog.Value {
+	return slog.StringValue("[REDACTED]")
+}
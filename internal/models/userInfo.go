@@ -4,4 +4,13 @@ type UserInfo struct {
 	ID    string
 	Agent string
 	IP    string
+	JKT   string // thumbprint of the DPoP key the client proved possession of
+	X5T   string // thumbprint of the client's TLS certificate
+	// ClientID of the OAuth client the tokens are issued to, empty for the
+	// service's own token endpoints.
+	ClientID string
+	// SessionID of the session being refreshed, empty to start a new one.
+	SessionID string
+	// Format of the access token to issue, empty for the default one.
+	Format string
 }
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// WebhookSubscription is an endpoint that receives the events of the given
+// types, or of every type if EventTypes is empty. Deliveries are signed with
+// Secret.
+type WebhookSubscription struct {
+	ID         string    `json:"id"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"` // returned only on creation
+	EventTypes []string  `json:"event_types"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,10 @@
+package repository
+
+import (
+	"context"
+	"jwt-service/internal/models"
+)
+
+type AudienceKeyRepository interface {
+	GetAudienceKey(ctx context.Context, audience string) (*models.AudienceKey, error)
+}
@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"jwt-service/internal/models"
+)
+
+type AuditRepository interface {
+	BeginTx(ctx context.Context) (pgx.Tx, error)
+	// LockChainHeadTx returns the sequence number and hash of the last
+	// event of the chain and locks them until tx ends, so events are
+	// chained one at a time.
+	LockChainHeadTx(ctx context.Context, tx pgx.Tx) (int64, []byte, error)
+	// SaveAuthEventTx appends event to the log and makes it the head of the
+	// chain.
+	SaveAuthEventTx(ctx context.Context, tx pgx.Tx, event models.AuthEvent) error
+	// ListAuthEvents returns up to limit events matching filter, newest
+	// first.
+	ListAuthEvents(ctx context.Context, filter models.AuthEventFilter, limit int) ([]models.AuthEvent, error)
+
+	// GetChainHead returns the sequence number and hash of the last event of
+	// the chain, without locking them.
+	GetChainHead(ctx context.Context) (int64, []byte, error)
+	// ListChainedAuthEvents returns up to limit events of the chain after
+	// seq, in chain order.
+	ListChainedAuthEvents(ctx context.Context, afterSeq int64, limit int) ([]models.AuthEvent, error)
+	// CountUnchainedAuthEvents returns how many events without a place in
+	// the chain were logged before and after its first event.
+	CountUnchainedAuthEvents(ctx context.Context) (before, after int64, err error)
+
+	SaveAuditCheckpoint(ctx context.Context, checkpoint models.AuditCheckpoint) error
+	// ListAuditCheckpoints returns every checkpoint in chain order.
+	ListAuditCheckpoints(ctx context.Context) ([]models.AuditCheckpoint, error)
+}
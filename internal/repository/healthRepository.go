@@ -0,0 +1,9 @@
+package repository
+
+import "context"
+
+type HealthRepository interface {
+	Ping(ctx context.Context) error
+	// GetSchemaVersion returns the version of the applied migrations.
+	GetSchemaVersion(ctx context.Context) (int, error)
+}
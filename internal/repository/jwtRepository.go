@@ -1,19 +1,25 @@
 package repository
 
 import (
+	"context"
 	"github.com/jackc/pgx/v5"
 	"jwt-service/internal/models"
 )
 
 type JWTRepository interface {
-	GetRefreshData(jti string) (*models.RefreshData, error)
-	RevokeRefresh(jti string) error
-	IsJWTBlacklisted(jti string) (bool, error)
+	GetRefreshData(ctx context.Context, jti string) (*models.RefreshData, error)
+	RevokeRefresh(ctx context.Context, jti string) error
+	IsJWTBlacklisted(ctx context.Context, jti string) (bool, error)
+	GetTokenVersion(ctx context.Context, userID string) (int64, error)
+	BumpTokenVersion(ctx context.Context, userID string) (int64, error)
 	Close()
 
-	BeginTx() (pgx.Tx, error)
-	SaveRefreshTx(tx pgx.Tx, data models.RefreshData) error
-	RevokeRefreshTx(tx pgx.Tx, jti string) error
-	RevokeAllRefreshTx(tx pgx.Tx, userID string) error
-	BlacklistJWTTx(tx pgx.Tx, jti string) error
+	BeginTx(ctx context.Context) (pgx.Tx, error)
+	SaveRefreshTx(ctx context.Context, tx pgx.Tx, data models.RefreshData) error
+	// RevokeRefreshTx revokes the refresh token jti. It returns
+	// errors2.ErrInvalidToken if the token is unknown or already revoked,
+	// so that of two concurrent refreshes of a token only one succeeds.
+	RevokeRefreshTx(ctx context.Context, tx pgx.Tx, jti string) error
+	RevokeAllRefreshTx(ctx context.Context, tx pgx.Tx, userID string) error
+	BlacklistJWTTx(ctx context.Context, tx pgx.Tx, jti string) error
 }
@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"context"
+	"jwt-service/internal/models"
+)
+
+type OAuthRepository interface {
+	GetClient(ctx context.Context, clientID string) (*models.OAuthClient, error)
+
+	SaveAuthCode(ctx context.Context, code models.AuthCode) error
+	// ConsumeAuthCode marks the code as used by the session sessionID,
+	// unless it already is, and returns it as it was before the update, so
+	// the caller can tell a first use from a replay and which session the
+	// first use started.
+	ConsumeAuthCode(ctx context.Context, codeHash, sessionID string) (*models.AuthCode, error)
+
+	SaveDeviceCode(ctx context.Context, code models.DeviceCode) error
+	GetDeviceCodeByUserCode(ctx context.Context, userCode string) (*models.DeviceCode, error)
+	// PollDeviceCode records a poll and returns the code as it was before it,
+	// so LastPolledAt holds the time of the previous poll.
+	PollDeviceCode(ctx context.Context, deviceCodeHash string) (*models.DeviceCode, error)
+	SetDeviceCodeInterval(ctx context.Context, deviceCodeHash string, interval int) error
+	// ResolveDeviceCode moves a pending code to the approved or denied status.
+	// It reports false when no pending, unexpired code matches userCode.
+	ResolveDeviceCode(ctx context.Context, userCode, userID, status string) (bool, error)
+	// ConsumeDeviceCode moves an approved code to the consumed status. It
+	// reports false when the code has already been consumed.
+	ConsumeDeviceCode(ctx context.Context, deviceCodeHash string) (bool, error)
+
+	GetExchangePolicy(ctx context.Context, clientID, audience string) (*models.ExchangePolicy, error)
+}
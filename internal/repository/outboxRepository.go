@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"jwt-service/internal/models"
+	"time"
+)
+
+type OutboxRepository interface {
+	BeginTx(ctx context.Context) (pgx.Tx, error)
+	SaveOutboxEventTx(ctx context.Context, tx pgx.Tx, event models.OutboxEvent) error
+	// SaveSubscribedEventsTx writes event to every subscription of its type,
+	// with the subscription's URL as the target.
+	SaveSubscribedEventsTx(ctx context.Context, tx pgx.Tx, event models.OutboxEvent) error
+
+	// ClaimOutboxEvents returns up to limit pending events that are due and
+	// postpones them by lease, so other dispatchers skip them meanwhile.
+	ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error)
+	MarkOutboxDelivered(ctx context.Context, id int64) error
+	// MarkOutboxFailed records a failed attempt. The event is retried after
+	// retryIn, or moved to the dead state if dead is set.
+	MarkOutboxFailed(ctx context.Context, id int64, lastError string, retryIn time.Duration, dead bool) error
+
+	// ListOutboxEvents returns up to limit events with the given status, or
+	// any status if it is empty, newest first.
+	ListOutboxEvents(ctx context.Context, status string, limit int) ([]models.OutboxEvent, error)
+	// RedeliverOutboxEventTx makes an event pending and due again with a
+	// fresh attempt count. It reports false if there is no such event.
+	RedeliverOutboxEventTx(ctx context.Context, tx pgx.Tx, id int64) (bool, error)
+	SaveAdminActionTx(ctx context.Context, tx pgx.Tx, action models.AdminAction) error
+
+	// GetWebhookSecret returns the signing secret of a subscription.
+	GetWebhookSecret(ctx context.Context, subscriptionID string) (string, error)
+	ListWebhookSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error)
+	SaveWebhookSubscriptionTx(ctx context.Context, tx pgx.Tx, sub models.WebhookSubscription) error
+	// DeleteWebhookSubscriptionTx reports false if there is no such
+	// subscription.
+	DeleteWebhookSubscriptionTx(ctx context.Context, tx pgx.Tx, id string) (bool, error)
+}
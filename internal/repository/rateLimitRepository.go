@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// RateLimitRepository keeps the state of the rate limits as the theoretical
+// arrival time (TAT) of every key, the time its limit is fully available
+// again: each request moves it forward by the emission interval of the
+// limit, window divided by the number of requests allowed in it.
+type RateLimitRepository interface {
+	// ReserveRateLimit moves the TAT of key, or now if it is earlier, by
+	// interval, unless that puts it more than window ahead of now. It
+	// returns the TAT and ok reporting whether it moved.
+	ReserveRateLimit(ctx context.Context, key string, now time.Time,
+		interval, window time.Duration) (tat time.Time, ok bool, err error)
+	// DeleteExpiredRateLimits deletes the keys whose TAT is before, which
+	// are as good as new.
+	DeleteExpiredRateLimits(ctx context.Context, before time.Time) (int64, error)
+}
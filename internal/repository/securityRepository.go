@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"jwt-service/internal/models"
+	"time"
+)
+
+type SecurityRepository interface {
+	// GetTokenNotBefore returns the time before which access tokens are
+	// rejected, or the zero time if the kill switch was never triggered.
+	GetTokenNotBefore(ctx context.Context) (time.Time, error)
+	// GetSigningKeys returns the keys of the keyring that are not retired,
+	// newest first.
+	GetSigningKeys(ctx context.Context) ([]models.SigningKey, error)
+
+	BeginTx(ctx context.Context) (pgx.Tx, error)
+	SetTokenNotBeforeTx(ctx context.Context, tx pgx.Tx, notBefore time.Time) error
+	// RevokeRefreshIssuedBeforeTx revokes every refresh token issued before
+	// t and returns how many were revoked.
+	RevokeRefreshIssuedBeforeTx(ctx context.Context, tx pgx.Tx, t time.Time) (int64, error)
+	// RotateSigningKeyTx retires every key of the keyring and adds key.
+	RotateSigningKeyTx(ctx context.Context, tx pgx.Tx, key models.SigningKey) error
+	SaveAdminActionTx(ctx context.Context, tx pgx.Tx, action models.AdminAction) error
+}
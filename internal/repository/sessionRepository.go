@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"jwt-service/internal/models"
+	"time"
+)
+
+type SessionRepository interface {
+	// ListSessions returns the sessions of userID that still have a
+	// non-revoked refresh token, most recently used first.
+	ListSessions(ctx context.Context, userID string) ([]models.Session, error)
+	// SearchSessions returns up to limit active sessions of any user whose
+	// current refresh token matches filter, most recently used first.
+	SearchSessions(ctx context.Context, filter models.SessionFilter, limit int) ([]models.Session, error)
+
+	BeginTx(ctx context.Context) (pgx.Tx, error)
+	// RevokeSessionTx revokes the refresh tokens of a session of userID and
+	// blacklists the access tokens issued in it after accessIssuedAfter. It
+	// reports false if userID has no such active session.
+	RevokeSessionTx(ctx context.Context, tx pgx.Tx, userID, sessionID string, accessIssuedAfter time.Time) (bool, error)
+	// RevokeSessionsTx does what RevokeSessionTx does for every session
+	// matching filter and returns how many sessions were revoked.
+	RevokeSessionsTx(ctx context.Context, tx pgx.Tx, filter models.SessionFilter, accessIssuedAfter time.Time) (int64, error)
+	SaveAdminActionTx(ctx context.Context, tx pgx.Tx, action models.AdminAction) error
+}
@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"context"
+	"jwt-service/internal/models"
+	"time"
+)
+
+type SinkRepository interface {
+	// ClaimSinkCursor leases the position of the named sink to owner for
+	// lease and returns the sequence number of the last event forwarded to
+	// it. A new sink starts at the current head of the audit log. ok is
+	// false if another owner holds an unexpired lease.
+	ClaimSinkCursor(ctx context.Context, name, owner string, lease time.Duration) (seq int64, ok bool, err error)
+	// AdvanceSinkCursor moves the position of the named sink from one
+	// sequence number to another. It returns false if owner lost the lease
+	// or the position is no longer from.
+	AdvanceSinkCursor(ctx context.Context, name, owner string, from, to int64) (bool, error)
+	// ReleaseSinkCursor ends the lease of owner, so that another instance
+	// can take over at once.
+	ReleaseSinkCursor(ctx context.Context, name, owner string) error
+	// ListChainedAuthEvents returns up to limit events of the audit log
+	// after seq, in chain order.
+	ListChainedAuthEvents(ctx context.Context, afterSeq int64, limit int) ([]models.AuthEvent, error)
+}
@@ -6,23 +6,77 @@ import (
 	"jwt-service/internal/handlers"
 	"jwt-service/internal/middleware"
 	"jwt-service/internal/repository"
+	"jwt-service/internal/services/audit"
+	"jwt-service/internal/services/dpop"
 	"jwt-service/internal/services/jwt-generator"
+	"jwt-service/internal/services/jwt-verifier"
+	"jwt-service/internal/services/kill-switch"
+	"jwt-service/internal/services/oauth"
+	"jwt-service/internal/services/outbox"
+	"jwt-service/internal/services/rate-limit"
+	"jwt-service/internal/services/sessions"
+	"jwt-service/internal/services/token-format"
+	"jwt-service/internal/services/token-version"
 )
 
-func RegisterRoutes(app *fiber.App, service jwt_generator.JWTGenerator, repo repository.JWTRepository, cfg *config.Config) {
+func RegisterRoutes(app *fiber.App, service jwt_generator.JWTGenerator, oauthService oauth.OAuthService,
+	sessionService sessions.SessionService, verifier jwt_verifier.JWTVerifier, versions token_version.TokenVersions,
+	killSwitch kill_switch.KillSwitch, outboxAdmin outbox.OutboxAdmin, subscriptions outbox.Subscriptions,
+	publisher outbox.Publisher, auditor audit.Auditor, validator dpop.ProofValidator, repo repository.JWTRepository,
+	limiter rate_limit.Limiter, formats *token_format.Formats, cfg *config.Config) {
+	app.Get("/.well-known/jwks.json", handlers.JWKS(formats))
+
 	api := app.Group("/api/v1")
+	authMiddleware := middleware.AuthMiddleware(verifier, validator, cfg)
+	// The pages a browser is redirected to cannot send an Authorization
+	// header, they are authenticated by a session cookie.
+	frontChannel := middleware.FrontChannelAuth(verifier, validator, cfg)
 
 	{
 		tokenPair := api.Group("/tokens")
 
-		tokenPair.Post("/generate", handlers.GenerateTokenPair(service))
-		tokenPair.Post("/refresh", handlers.RefreshTokenPair(service))
+		tokenPair.Post("/generate", handlers.GenerateTokenPair(service, validator),
+			middleware.RateLimit(limiter, middleware.QueryUser))
+		tokenPair.Post("/refresh", handlers.RefreshTokenPair(service, validator),
+			middleware.RateLimit(limiter, middleware.TokenPairUser(formats)))
+	}
+
+	{
+		oauthGroup := api.Group("/oauth")
+
+		oauthGroup.Get("/authorize", handlers.Authorize(oauthService), frontChannel)
+		oauthGroup.Post("/token", handlers.Token(oauthService, validator),
+			middleware.RateLimit(limiter, middleware.OAuthClient))
+		oauthGroup.Post("/device_authorization", handlers.DeviceAuthorization(oauthService))
+		oauthGroup.Get("/device", handlers.DeviceVerification(oauthService), frontChannel)
+		oauthGroup.Post("/device", handlers.VerifyDevice(oauthService), frontChannel)
+		oauthGroup.Post("/session", handlers.CreateOAuthSession(cfg), authMiddleware)
+		oauthGroup.Delete("/session", handlers.DeleteOAuthSession(cfg))
+	}
+
+	// Admin tokens are only issued to admin client certificates, without
+	// them nobody could use the admin API.
+	if len(cfg.AdminClientCerts) > 0 {
+		admin := api.Group("/admin", authMiddleware, middleware.RequireScope(jwt_generator.ScopeAdmin))
+
+		admin.Post("/kill-switch", handlers.KillSwitch(killSwitch))
+		admin.Get("/sessions", handlers.SearchSessions(sessionService))
+		admin.Post("/sessions/revoke", handlers.RevokeSessions(sessionService))
+		admin.Get("/outbox", handlers.ListOutboxEvents(outboxAdmin))
+		admin.Post("/outbox/:id/redeliver", handlers.RedeliverOutboxEvent(outboxAdmin))
+		admin.Get("/webhooks", handlers.ListWebhooks(subscriptions))
+		admin.Post("/webhooks", handlers.CreateWebhook(subscriptions))
+		admin.Delete("/webhooks/:id", handlers.DeleteWebhook(subscriptions))
+		admin.Get("/auth-events", handlers.ListAuthEvents(auditor))
 	}
 
 	{
-		auth := api.Group("/", middleware.AuthMiddleware(repo, cfg))
+		auth := api.Group("/", authMiddleware)
 
 		auth.Get("/whoami", handlers.Whoami)
-		auth.Post("/logout", handlers.Logout(repo))
+		auth.Post("/logout", handlers.Logout(repo, versions, publisher, auditor))
+		auth.Get("/sessions", handlers.ListSessions(sessionService))
+		auth.Post("/sessions/revoke-others", handlers.RevokeOtherSessions(sessionService))
+		auth.Delete("/sessions/:id", handlers.RevokeSession(sessionService))
 	}
 }
@@ -0,0 +1,235 @@
+package audit
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	errors2 "jwt-service/internal/errors"
+	"jwt-service/internal/logging"
+	"jwt-service/internal/models"
+	"jwt-service/internal/repository"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Event types of the audit log. Admin actions are logged as "admin." followed
+// by the action.
+const (
+	EventTokenIssued    = "token.issued"
+	EventTokenRefreshed = "token.refreshed"
+	EventTokenRevoked   = "token.revoked"
+	EventTokenReused    = "token.reuse_detected"
+	EventSessionRevoked = "session.revoked"
+	EventLogout         = "logout"
+
+	adminEventPrefix = "admin."
+	anonymousActor   = "anonymous"
+
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+var outcomes = []string{models.OutcomeSuccess, models.OutcomeFailure}
+
+type Auditor interface {
+	// Record appends event to the audit log on its own. It is meant for
+	// failures, which have no transaction to join, and only logs errors.
+	Record(ctx context.Context, event models.AuthEvent)
+	// RecordTx appends event to the audit log within tx, so it is kept if and
+	// only if tx commits. Events are chained one at a time, so it should be
+	// the last statement of tx.
+	RecordTx(ctx context.Context, tx pgx.Tx, event models.AuthEvent) error
+	// List returns a page of the events matching req, newest first.
+	List(ctx context.Context, req *models.AuthEventListRequest) (*models.AuthEventPage, error)
+}
+
+type AuditorImpl struct {
+	repo repository.AuditRepository
+}
+
+func New(repo repository.AuditRepository) *AuditorImpl {
+	return &AuditorImpl{
+		repo: repo,
+	}
+}
+
+func (a *AuditorImpl) Record(ctx context.Context, event models.AuthEvent) {
+	// Failures are recorded even if they were caused by the request being
+	// canceled.
+	if err := a.record(context.WithoutCancel(ctx), event); err != nil {
+		slog.ErrorContext(ctx, "Failed to record audit event", "event_type", event.EventType, "error", err)
+	}
+}
+
+func (a *AuditorImpl) record(ctx context.Context, event models.AuthEvent) error {
+	tx, err := a.repo.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err = a.RecordTx(ctx, tx, event); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// RecordTx chains event to the head of the log. The head stays locked until
+// tx ends, callers should record events last, right before committing.
+func (a *AuditorImpl) RecordTx(ctx context.Context, tx pgx.Tx, event models.AuthEvent) error {
+	seq, hash, err := a.repo.LockChainHeadTx(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	event = normalize(event)
+	if event.RequestID == "" {
+		event.RequestID = logging.RequestID(ctx)
+	}
+	event.Seq = seq + 1
+	event.PrevHash = hash
+	// The precision of timestamptz, so the hash can be recomputed from the
+	// stored event.
+	event.CreatedAt = time.Now().Truncate(time.Microsecond)
+	event.Hash = hashEvent(event)
+
+	return a.repo.SaveAuthEventTx(ctx, tx, event)
+}
+
+func (a *AuditorImpl) List(ctx context.Context, req *models.AuthEventListRequest) (*models.AuthEventPage, error) {
+	filter, err := parseFilter(req)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := min(req.Limit, maxListLimit)
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+
+	// One more than asked tells whether there is a next page.
+	events, err := a.repo.ListAuthEvents(ctx, filter, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.AuthEventPage{Events: events}
+	if len(events) > limit {
+		page.Events = events[:limit]
+		page.NextCursor = encodeCursor(page.Events[limit-1].ID)
+	}
+	if page.Events == nil {
+		page.Events = []models.AuthEvent{}
+	}
+
+	return page, nil
+}
+
+// UserActor identifies a user acting on their own behalf, or the OAuth
+// client acting for them if clientID is set.
+func UserActor(userID, clientID string) string {
+	if clientID != "" {
+		return "client:" + clientID
+	}
+	if userID == "" {
+		return anonymousActor
+	}
+
+	return "user:" + userID
+}
+
+// AdminEvent returns the audit log entry of an admin action.
+func AdminEvent(action models.AdminAction) models.AuthEvent {
+	return models.AuthEvent{
+		EventType: adminEventPrefix + action.Action,
+		Outcome:   models.OutcomeSuccess,
+		Actor:     action.Actor,
+		Reason:    action.Reason,
+	}
+}
+
+func normalize(event models.AuthEvent) models.AuthEvent {
+	if event.Actor == "" {
+		event.Actor = anonymousActor
+	}
+	if event.Outcome == "" {
+		event.Outcome = models.OutcomeSuccess
+	}
+
+	return event
+}
+
+func parseFilter(req *models.AuthEventListRequest) (models.AuthEventFilter, error) {
+	filter := models.AuthEventFilter{
+		EventType: req.EventType,
+		Outcome:   req.Outcome,
+		Actor:     req.Actor,
+		Subject:   req.Subject,
+		ClientID:  req.ClientID,
+	}
+
+	if req.Outcome != "" && !slices.Contains(outcomes, req.Outcome) {
+		return filter, fmt.Errorf("%w: outcome must be one of %v", errors2.ErrInvalidFilter, outcomes)
+	}
+
+	if req.IP != "" {
+		prefix, err := models.ParseIPPrefix(req.IP)
+		if err != nil {
+			return filter, fmt.Errorf("%w: ip must be an address or a CIDR", errors2.ErrInvalidFilter)
+		}
+		filter.IP = &prefix
+	}
+
+	var err error
+	if filter.Since, err = parseTime(req.Since, "since"); err != nil {
+		return filter, err
+	}
+	if filter.Until, err = parseTime(req.Until, "until"); err != nil {
+		return filter, err
+	}
+
+	if req.Cursor != "" {
+		if filter.BeforeID, err = decodeCursor(req.Cursor); err != nil {
+			return filter, fmt.Errorf("%w: invalid cursor", errors2.ErrInvalidFilter)
+		}
+	}
+
+	return filter, nil
+}
+
+func parseTime(s, name string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s must be an RFC 3339 time", errors2.ErrInvalidFilter, name)
+	}
+
+	return &t, nil
+}
+
+// Cursors are opaque to clients, so the paging scheme can change without
+// breaking them.
+func encodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+func decodeCursor(cursor string) (int64, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid cursor %q", cursor)
+	}
+
+	return id, nil
+}
@@ -0,0 +1,110 @@
+package audit
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"jwt-service/internal/config"
+	"jwt-service/internal/models"
+	"jwt-service/internal/repository"
+	"log/slog"
+	"time"
+)
+
+// checkpointInterval bounds how long events stay at the end of the chain
+// without a signed checkpoint covering them.
+const checkpointInterval = 5 * time.Minute
+
+// Checkpointer periodically signs the head of the audit log chain with
+// AUDIT_SIGNING_KEY. The key is kept out of the database, so rewriting the
+// chain before a checkpoint takes the key, not just write access to the
+// database, and audit verify checks the signatures with public keys only.
+type Checkpointer struct {
+	repo repository.AuditRepository
+	key  ed25519.PrivateKey
+	kid  string
+
+	lastSeq int64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewCheckpointer(repo repository.AuditRepository, cfg *config.Config) (*Checkpointer, error) {
+	key, err := parseSigningKey(cfg.AuditSigningKey)
+	if err != nil {
+		return nil, fmt.Errorf("AUDIT_SIGNING_KEY: %w", err)
+	}
+
+	kid, err := keyID(key.Public().(ed25519.PublicKey))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Checkpointer{
+		repo: repo,
+		key:  key,
+		kid:  kid,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}, nil
+}
+
+// Run signs a checkpoint whenever the chain has grown, until ctx is done or
+// Shutdown is called.
+func (c *Checkpointer) Run(ctx context.Context) {
+	defer close(c.done)
+
+	ticker := time.NewTicker(checkpointInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			if err := c.Checkpoint(ctx); err != nil {
+				slog.ErrorContext(ctx, "Failed to checkpoint audit log", "error", err)
+			}
+		}
+	}
+}
+
+// Shutdown stops Run and signs a last checkpoint, so the events recorded
+// since the previous one do not wait for the next instance to be covered.
+func (c *Checkpointer) Shutdown(ctx context.Context) error {
+	close(c.stop)
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return c.Checkpoint(ctx)
+}
+
+// Checkpoint signs the current head of the chain, unless it already is.
+func (c *Checkpointer) Checkpoint(ctx context.Context) error {
+	seq, hash, err := c.repo.GetChainHead(ctx)
+	if err != nil {
+		return err
+	}
+	if seq == 0 || seq == c.lastSeq {
+		return nil
+	}
+
+	err = c.repo.SaveAuditCheckpoint(ctx, models.AuditCheckpoint{
+		Seq:       seq,
+		Hash:      hash,
+		KID:       c.kid,
+		Signature: ed25519.Sign(c.key, checkpointMessage(seq, hash)),
+	})
+	if err != nil {
+		return err
+	}
+	c.lastSeq = seq
+
+	return nil
+}
@@ -0,0 +1,189 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"jwt-service/internal/config"
+	"jwt-service/internal/models"
+	"jwt-service/internal/repository"
+	"maps"
+	"slices"
+)
+
+const (
+	verifyBatchSize = 1000
+	maxProblems     = 100
+)
+
+// VerifyReport is the outcome of an audit log verification.
+type VerifyReport struct {
+	// Events is the number of chained events checked.
+	Events int64
+	// Checkpoints is the number of valid checkpoints, LastCheckpoint the
+	// sequence number of the newest one. Events after it are not covered by
+	// a signature.
+	Checkpoints    int
+	LastCheckpoint int64
+	// Unchained is the number of events logged before the chain started.
+	Unchained int64
+	// Problems describes every gap, modification or invalid checkpoint
+	// found, up to maxProblems.
+	Problems []string
+	// Truncated is set if there were more problems than listed.
+	Truncated bool
+}
+
+func (r *VerifyReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *VerifyReport) problem(format string, args ...any) {
+	if len(r.Problems) == maxProblems {
+		r.Truncated = true
+		return
+	}
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+// ChainVerifier checks the audit log hash chain and its checkpoints.
+type ChainVerifier struct {
+	repo repository.AuditRepository
+	// keys are the public keys of AUDIT_VERIFY_KEYS and of AUDIT_SIGNING_KEY
+	// by their kid. Keys in the database are never trusted, whoever can
+	// rewrite the chain could replace them too.
+	keys map[string]ed25519.PublicKey
+}
+
+func NewChainVerifier(repo repository.AuditRepository, cfg *config.Config) (*ChainVerifier, error) {
+	var publicKeys []ed25519.PublicKey
+	if cfg.AuditSigningKey != "" {
+		key, err := parseSigningKey(cfg.AuditSigningKey)
+		if err != nil {
+			return nil, fmt.Errorf("AUDIT_SIGNING_KEY: %w", err)
+		}
+		publicKeys = append(publicKeys, key.Public().(ed25519.PublicKey))
+	}
+	for _, hexKey := range cfg.AuditVerifyKeys {
+		key, err := parseVerifyKey(hexKey)
+		if err != nil {
+			return nil, fmt.Errorf("AUDIT_VERIFY_KEYS: %w", err)
+		}
+		publicKeys = append(publicKeys, key)
+	}
+
+	keys := make(map[string]ed25519.PublicKey, len(publicKeys))
+	for _, key := range publicKeys {
+		kid, err := keyID(key)
+		if err != nil {
+			return nil, err
+		}
+		keys[kid] = key
+	}
+
+	return &ChainVerifier{
+		repo: repo,
+		keys: keys,
+	}, nil
+}
+
+// Verify walks the whole chain. An error means the verification could not be
+// completed, problems with the log itself are listed in the report.
+func (v *ChainVerifier) Verify(ctx context.Context) (*VerifyReport, error) {
+	report := &VerifyReport{}
+
+	checkpoints, err := v.validCheckpoints(ctx, report)
+	if err != nil {
+		return nil, err
+	}
+
+	seq := int64(0)
+	hash := []byte{}
+	for {
+		events, err := v.repo.ListChainedAuthEvents(ctx, seq, verifyBatchSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range events {
+			switch {
+			case e.Seq != seq+1:
+				report.problem("events %d to %d are missing", seq+1, e.Seq-1)
+			case !bytes.Equal(e.PrevHash, hash):
+				report.problem("event %d (id %d) does not link to event %d", e.Seq, e.ID, seq)
+			}
+			if !bytes.Equal(hashEvent(e), e.Hash) {
+				report.problem("event %d (id %d) was modified", e.Seq, e.ID)
+			}
+
+			if checkpoint, ok := checkpoints[e.Seq]; ok {
+				if !bytes.Equal(checkpoint.Hash, e.Hash) {
+					report.problem("event %d (id %d) does not match its checkpoint, "+
+						"the chain was rewritten up to it", e.Seq, e.ID)
+				}
+				delete(checkpoints, e.Seq)
+			}
+
+			seq, hash = e.Seq, e.Hash
+			report.Events++
+		}
+
+		if len(events) < verifyBatchSize {
+			break
+		}
+	}
+
+	for _, checkpointSeq := range slices.Sorted(maps.Keys(checkpoints)) {
+		report.problem("event %d of a checkpoint is missing", checkpointSeq)
+	}
+
+	headSeq, headHash, err := v.repo.GetChainHead(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if headSeq != seq || !bytes.Equal(headHash, hash) {
+		report.problem("the chain ends at event %d, but its head is event %d", seq, headSeq)
+	}
+
+	before, after, err := v.repo.CountUnchainedAuthEvents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report.Unchained = before
+	if after > 0 {
+		report.problem("%d events were added outside the chain", after)
+	}
+
+	return report, nil
+}
+
+// validCheckpoints returns the checkpoints with a valid signature by their
+// sequence number and reports the others.
+func (v *ChainVerifier) validCheckpoints(ctx context.Context,
+	report *VerifyReport) (map[int64]models.AuditCheckpoint, error) {
+	checkpoints, err := v.repo.ListAuditCheckpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	valid := make(map[int64]models.AuditCheckpoint, len(checkpoints))
+	for _, checkpoint := range checkpoints {
+		key, ok := v.keys[checkpoint.KID]
+		if !ok {
+			report.problem("checkpoint at event %d is signed with unknown key %q, add its public key to "+
+				"AUDIT_VERIFY_KEYS to verify the checkpoint", checkpoint.Seq, checkpoint.KID)
+			continue
+		}
+		if !ed25519.Verify(key, checkpointMessage(checkpoint.Seq, checkpoint.Hash), checkpoint.Signature) {
+			report.problem("checkpoint at event %d has an invalid signature", checkpoint.Seq)
+			continue
+		}
+
+		valid[checkpoint.Seq] = checkpoint
+		report.Checkpoints++
+		report.LastCheckpoint = checkpoint.Seq
+	}
+
+	return valid, nil
+}
@@ -0,0 +1,148 @@
+package dpop
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	errors2 "jwt-service/internal/errors"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// HeaderName is the request header carrying the DPoP proof.
+	HeaderName = "DPoP"
+	// TokenType is the token_type of DPoP-bound tokens and the authorization
+	// scheme they are presented with.
+	TokenType = "DPoP"
+
+	proofType = "dpop+jwt"
+	// proofLifetime bounds how old a proof may be, and for how long its jti
+	// is remembered. clockSkew tolerates clients whose clock runs ahead.
+	proofLifetime = 5 * time.Minute
+	clockSkew     = 30 * time.Second
+)
+
+var signingMethods = []string{"ES256", "ES384", "ES512", "RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "EdDSA"}
+
+type ProofValidator interface {
+	// Validate checks a DPoP proof (RFC 9449, section 4.3) for a request with
+	// the given method and URL and returns the JWK thumbprint of its key.
+	// accessToken is the token the proof is presented with, if any.
+	Validate(proof, method, requestURL, accessToken string) (string, error)
+}
+
+type ProofValidatorImpl struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	lastPrune time.Time
+}
+
+func New() *ProofValidatorImpl {
+	return &ProofValidatorImpl{
+		seen:      make(map[string]time.Time),
+		lastPrune: time.Now(),
+	}
+}
+
+func (v *ProofValidatorImpl) Validate(proof, method, requestURL, accessToken string) (string, error) {
+	var key *jwk
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(proof, claims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != proofType {
+			return nil, fmt.Errorf("unexpected typ %q", typ)
+		}
+
+		var err error
+		if key, err = parseJWK(token.Header["jwk"]); err != nil {
+			return nil, err
+		}
+
+		return key.publicKey()
+	}, jwt.WithValidMethods(signingMethods))
+	if err != nil || !token.Valid {
+		return "", fmt.Errorf("%w: %v", errors2.ErrInvalidDPoPProof, err)
+	}
+
+	jti, _ := claims["jti"].(string)
+	htm, _ := claims["htm"].(string)
+	htu, _ := claims["htu"].(string)
+	iat, err := claims.GetIssuedAt()
+	switch {
+	case jti == "":
+		return "", fmt.Errorf("%w: missing jti", errors2.ErrInvalidDPoPProof)
+	case htm != method:
+		return "", fmt.Errorf("%w: htm mismatch", errors2.ErrInvalidDPoPProof)
+	case !sameURL(htu, requestURL):
+		return "", fmt.Errorf("%w: htu mismatch", errors2.ErrInvalidDPoPProof)
+	case err != nil || iat == nil:
+		return "", fmt.Errorf("%w: missing iat", errors2.ErrInvalidDPoPProof)
+	case time.Since(iat.Time) > proofLifetime || time.Until(iat.Time) > clockSkew:
+		return "", fmt.Errorf("%w: iat out of range", errors2.ErrInvalidDPoPProof)
+	}
+
+	if accessToken != "" {
+		ath, _ := claims["ath"].(string)
+		sum := sha256.Sum256([]byte(accessToken))
+		expected := base64.RawURLEncoding.EncodeToString(sum[:])
+		if subtle.ConstantTimeCompare([]byte(ath), []byte(expected)) != 1 {
+			return "", fmt.Errorf("%w: ath mismatch", errors2.ErrInvalidDPoPProof)
+		}
+	}
+
+	jkt, err := key.thumbprint()
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errors2.ErrInvalidDPoPProof, err)
+	}
+
+	if !v.remember(jkt+":"+jti, iat.Add(proofLifetime)) {
+		return "", fmt.Errorf("%w: proof replayed", errors2.ErrInvalidDPoPProof)
+	}
+
+	return jkt, nil
+}
+
+// remember records a proof until it expires. It reports false if the proof
+// has already been seen.
+func (v *ProofValidatorImpl) remember(id string, expiresAt time.Time) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(v.lastPrune) > time.Minute {
+		for k, exp := range v.seen {
+			if now.After(exp) {
+				delete(v.seen, k)
+			}
+		}
+		v.lastPrune = now
+	}
+
+	if exp, ok := v.seen[id]; ok && now.Before(exp) {
+		return false
+	}
+	v.seen[id] = expiresAt
+
+	return true
+}
+
+// sameURL compares htu with the request URL ignoring query and fragment, and
+// the case of the scheme and host (RFC 9449, section 4.3).
+func sameURL(htu, requestURL string) bool {
+	a, err := url.Parse(htu)
+	if err != nil {
+		return false
+	}
+	b, err := url.Parse(requestURL)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(a.Scheme, b.Scheme) &&
+		strings.EqualFold(a.Host, b.Host) &&
+		a.Path == b.Path
+}
@@ -0,0 +1,51 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"jwt-service/internal/repository"
+	token_format "jwt-service/internal/services/token-format"
+)
+
+// Postgres checks that the database is reachable.
+func Postgres(repo repository.HealthRepository) Check {
+	return Check{Name: "postgres", Run: repo.Ping}
+}
+
+// Migrations checks that the database schema is at least at version want.
+// A newer schema passes, as migrations only add to it and the previous
+// release keeps running while a new one rolls out.
+func Migrations(repo repository.HealthRepository, want int) Check {
+	return Check{Name: "migrations", Run: func(ctx context.Context) error {
+		version, err := repo.GetSchemaVersion(ctx)
+		if err != nil {
+			return err
+		}
+		if version < want {
+			return fmt.Errorf("schema version %d, want %d", version, want)
+		}
+
+		return nil
+	}}
+}
+
+// SigningKey checks that the key access tokens are signed with is loaded.
+func SigningKey(formats *token_format.Formats) Check {
+	return Check{Name: "signing_key", Run: func(context.Context) error {
+		_, key, err := formats.SigningKey()
+		if err != nil {
+			return err
+		}
+		if len(key) == 0 {
+			return errors.New("no signing key")
+		}
+
+		return nil
+	}}
+}
+
+// Dispatcher checks that the webhook dispatcher is not wedged.
+func Dispatcher(check func(ctx context.Context) error) Check {
+	return Check{Name: "webhook_dispatcher", Run: check}
+}
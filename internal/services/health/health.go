@@ -0,0 +1,140 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"jwt-service/internal/models"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+
+	// checkTimeout bounds every check, so a hung dependency fails the probe
+	// instead of timing it out.
+	checkTimeout = 2 * time.Second
+)
+
+// Check is a named readiness check, it fails by returning an error.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+type Health interface {
+	// Live reports whether the process is alive, which it is if it can
+	// respond at all.
+	Live(ctx context.Context) models.HealthReport
+	// Ready runs every check and reports whether the service can take
+	// traffic. It fails once the service starts draining.
+	Ready(ctx context.Context) models.HealthReport
+	// Started reports whether the service has started: it runs the checks
+	// until they first pass, and passes from then on.
+	Started(ctx context.Context) models.HealthReport
+	// Drain makes Ready fail, so traffic is routed away before shutdown.
+	Drain()
+}
+
+type HealthImpl struct {
+	checks []Check
+
+	started  atomic.Bool
+	draining atomic.Bool
+}
+
+func New(checks ...Check) *HealthImpl {
+	return &HealthImpl{
+		checks: checks,
+	}
+}
+
+func (h *HealthImpl) Live(context.Context) models.HealthReport {
+	return report(map[string]models.CheckResult{
+		"process": {Status: StatusOK},
+	})
+}
+
+func (h *HealthImpl) Ready(ctx context.Context) models.HealthReport {
+	results := h.run(ctx)
+
+	shutdown := models.CheckResult{Status: StatusOK}
+	if h.draining.Load() {
+		shutdown = models.CheckResult{Status: StatusFail, Error: "draining"}
+	}
+	results["shutdown"] = shutdown
+
+	return report(results)
+}
+
+func (h *HealthImpl) Started(ctx context.Context) models.HealthReport {
+	if h.started.Load() {
+		return report(map[string]models.CheckResult{
+			"startup": {Status: StatusOK},
+		})
+	}
+
+	r := report(h.run(ctx))
+	if r.Status == StatusOK {
+		h.started.Store(true)
+	}
+
+	return r
+}
+
+func (h *HealthImpl) Drain() {
+	h.draining.Store(true)
+}
+
+// run runs the checks concurrently.
+func (h *HealthImpl) run(ctx context.Context) map[string]models.CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]models.CheckResult, len(h.checks)+1)
+	for _, check := range h.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			start := time.Now()
+			err := check.Run(ctx)
+			result := models.CheckResult{
+				Status:     StatusOK,
+				DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				result.Status = StatusFail
+				result.Error = err.Error()
+				if errors.Is(err, context.DeadlineExceeded) {
+					result.Error = "timed out"
+				}
+			}
+
+			mu.Lock()
+			results[check.Name] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
+
+func report(results map[string]models.CheckResult) models.HealthReport {
+	status := StatusOK
+	for _, result := range results {
+		if result.Status != StatusOK {
+			status = StatusFail
+		}
+	}
+
+	return models.HealthReport{
+		Status: status,
+		Checks: results,
+	}
+}
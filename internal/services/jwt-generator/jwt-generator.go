@@ -1,58 +1,151 @@
 package jwt_generator
 
 import (
-	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/gofiber/fiber/v3/log"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/crypto/bcrypt"
 	"jwt-service/internal/config"
 	errors2 "jwt-service/internal/errors"
+	"jwt-service/internal/metrics"
 	"jwt-service/internal/models"
 	"jwt-service/internal/repository"
-	"net/http"
+	"jwt-service/internal/services/audit"
+	"jwt-service/internal/services/outbox"
+	token_format "jwt-service/internal/services/token-format"
+	"log/slog"
+	"slices"
 	"time"
 )
 
+var tracer = otel.Tracer("jwt-service/internal/services/jwt-generator")
+
+const (
+	// ScopeAdmin grants access to the admin API. It is given to the users
+	// listed in ADMIN_USER_IDS, and only in tokens issued by the service's
+	// own token endpoints to a client certificate listed in
+	// ADMIN_CLIENT_CERTS, never to OAuth clients.
+	ScopeAdmin = "admin"
+)
+
 type JWTGenerator interface {
-	GenerateTokenPair(*models.UserInfo) (*models.TokenPair, error)
+	GenerateTokenPair(ctx context.Context, userInfo *models.UserInfo) (*models.TokenPair, error)
+	// IssueAccessToken issues an access token without a refresh token in the
+	// named format, or the default one if format is empty. Missing jti, iat
+	// and exp claims are filled with defaults, ver with the subject's current
+	// token version.
+	IssueAccessToken(ctx context.Context, claims *models.AccessClaims, format string) (string, error)
 	RefreshTokenPair(ctx context.Context,
 		tokenPair *models.TokenPair, info *models.UserInfo) (*models.TokenPair, error)
 }
 
 type JWTGeneratorImpl struct {
 	repo       repository.JWTRepository
-	jwtSecret  []byte
-	webhookUrl string
+	formats    *token_format.Formats
+	publisher  outbox.Publisher
+	auditor    audit.Auditor
+	adminUsers []string
+	adminCerts []string
+	accessTTL  time.Duration
 }
 
-func New(repo repository.JWTRepository, cfg *config.Config) *JWTGeneratorImpl {
+func New(repo repository.JWTRepository, cfg *config.Config, formats *token_format.Formats,
+	publisher outbox.Publisher, auditor audit.Auditor) *JWTGeneratorImpl {
 	return &JWTGeneratorImpl{
 		repo:       repo,
-		jwtSecret:  []byte(cfg.JWTSecret),
-		webhookUrl: cfg.WebhookURL,
+		formats:    formats,
+		publisher:  publisher,
+		auditor:    auditor,
+		adminUsers: cfg.AdminUserIDs,
+		adminCerts: cfg.AdminClientCerts,
+		accessTTL:  cfg.AccessTokenTTL,
+	}
+}
+
+func (j *JWTGeneratorImpl) GenerateTokenPair(ctx context.Context, userInfo *models.UserInfo) (*models.TokenPair, error) {
+	ctx, span := tracer.Start(ctx, "JWTGenerator.GenerateTokenPair")
+	defer span.End()
+
+	tokenPair, err := j.generateTokenPair(ctx, userInfo)
+	if err != nil {
+		recordError(span, err)
+		j.auditor.Record(ctx, authEvent(audit.EventTokenIssued, models.OutcomeFailure, userInfo, err.Error()))
+	} else {
+		metrics.TokensIssued.Inc()
 	}
+
+	return tokenPair, err
 }
 
-func (j *JWTGeneratorImpl) GenerateTokenPair(userInfo *models.UserInfo) (*models.TokenPair, error) {
-	token := jwt.New(jwt.SigningMethodHS512)
+func (j *JWTGeneratorImpl) generateTokenPair(ctx context.Context, userInfo *models.UserInfo) (*models.TokenPair, error) {
+	tx, err := j.repo.BeginTx(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to start tx", "error", err)
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	tokenPair, err := j.generateTokenPairTx(ctx, tx, userInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = j.publisher.PublishTx(ctx, tx, outbox.EventTokenIssued, userInfo.ID, sessionEvent(userInfo)); err != nil {
+		slog.ErrorContext(ctx, "Failed to publish event", "error", err)
+		return nil, err
+	}
 
+	err = j.auditor.RecordTx(ctx, tx, authEvent(audit.EventTokenIssued, models.OutcomeSuccess, userInfo, ""))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to record audit event", "error", err)
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		slog.ErrorContext(ctx, "Tx commit failed", "error", err)
+
+		return nil, err
+	}
+
+	return tokenPair, nil
+}
+
+// generateTokenPairTx issues a token pair and saves its refresh token within
+// tx, so it only becomes valid if tx commits. The pair belongs to the session
+// of userInfo, a new one is started if it has none.
+func (j *JWTGeneratorImpl) generateTokenPairTx(ctx context.Context, tx pgx.Tx,
+	userInfo *models.UserInfo) (*models.TokenPair, error) {
 	jti := fmt.Sprintf("%d", time.Now().UnixNano())
-	token.Claims = jwt.MapClaims{
-		"sub": userInfo.ID,
-		"exp": time.Now().Add(15 * time.Minute).Unix(),
-		"iat": time.Now().Unix(),
-		"jti": jti,
+	if userInfo.SessionID == "" {
+		userInfo.SessionID = uuid.NewString()
+	}
+	sessionID := userInfo.SessionID
+	claims := &models.AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject: userInfo.ID,
+			ID:      jti,
+		},
+		ClientID:  userInfo.ClientID,
+		SessionID: sessionID,
+	}
+	if j.admin(userInfo) {
+		claims.Scope = ScopeAdmin
+	}
+	if userInfo.JKT != "" || userInfo.X5T != "" {
+		claims.Cnf = &models.Confirmation{JKT: userInfo.JKT, X5TS256: userInfo.X5T}
 	}
 
-	accessToken, err := token.SignedString(j.jwtSecret)
+	accessToken, err := j.issueAccessToken(ctx, claims, userInfo.Format)
 	if err != nil {
-		log.Errorf("failed to get signed string: %v", err)
 		return nil, err
 	}
 
@@ -62,19 +155,12 @@ func (j *JWTGeneratorImpl) GenerateTokenPair(userInfo *models.UserInfo) (*models
 	sha := sha256.Sum256([]byte(refreshToken))
 	short := hex.EncodeToString(sha[:])
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(short), bcrypt.DefaultCost)
+	hash, err := hashRefreshToken(ctx, short)
 	if err != nil {
-		log.Errorf("failed to generate bcrytp: %v", err)
+		slog.ErrorContext(ctx, "failed to generate bcrytp", "error", err)
 		return nil, fmt.Errorf("failed to generate bcrypt: %v", err)
 	}
 
-	tx, err := j.repo.BeginTx()
-	if err != nil {
-		log.Errorf("failed to start tx")
-		return nil, err
-	}
-	defer tx.Rollback(context.Background())
-
 	refreshData := models.RefreshData{
 		JTI:       jti,
 		UserID:    userInfo.ID,
@@ -82,89 +168,203 @@ func (j *JWTGeneratorImpl) GenerateTokenPair(userInfo *models.UserInfo) (*models
 		UserAgent: userInfo.Agent,
 		IP:        userInfo.IP,
 		IssuedAt:  time.Now(),
+		JKT:       userInfo.JKT,
+		X5T:       userInfo.X5T,
+		SessionID: sessionID,
 	}
 
-	log.Infof("Refresh data: %v", refreshData)
-
-	err = j.repo.SaveRefreshTx(tx, refreshData)
+	err = j.repo.SaveRefreshTx(ctx, tx, refreshData)
 	if err != nil {
 		return nil, err
 	}
 
-	if err = tx.Commit(context.Background()); err != nil {
-		log.Errorf("Tx commit failed: %v", err)
-
-		return nil, err
-	}
-
 	return &models.TokenPair{
 		Access:  accessToken,
 		Refresh: refreshToken,
 	}, nil
 }
 
-func (j *JWTGeneratorImpl) RefreshTokenPair(ctx context.Context, tokenPair *models.TokenPair, userInfo *models.UserInfo) (*models.TokenPair, error) {
-	access, err := jwt.Parse(tokenPair.Access, func(token *jwt.Token) (interface{}, error) {
-		if token.Method != jwt.SigningMethodHS512 {
-			return nil, errors2.ErrUnexpectedHashMethod
-		}
+// admin reports whether the tokens of userInfo get the admin scope. The
+// user_id of a request is not authenticated, so the request must also come
+// with an admin's client certificate, which the token is then bound to.
+func (j *JWTGeneratorImpl) admin(userInfo *models.UserInfo) bool {
+	return userInfo.ClientID == "" && userInfo.X5T != "" &&
+		slices.Contains(j.adminCerts, userInfo.X5T) && slices.Contains(j.adminUsers, userInfo.ID)
+}
+
+func (j *JWTGeneratorImpl) IssueAccessToken(ctx context.Context, claims *models.AccessClaims,
+	format string) (string, error) {
+	ctx, span := tracer.Start(ctx, "JWTGenerator.IssueAccessToken")
+	defer span.End()
+
+	accessToken, err := j.issueAccessToken(ctx, claims, format)
+	if err != nil {
+		recordError(span, err)
+	} else {
+		metrics.TokensIssued.Inc()
+	}
 
-		return j.jwtSecret, nil
-	})
-	if err != nil || !access.Valid {
+	return accessToken, err
+}
+
+func (j *JWTGeneratorImpl) issueAccessToken(ctx context.Context, claims *models.AccessClaims,
+	format string) (string, error) {
+	tokenFormat, err := j.formats.Get(format)
+	if err != nil {
+		return "", err
+	}
+
+	// Read past the verifier's cache, a token issued with a stale version
+	// would be rejected as soon as the cache catches up.
+	version, err := j.repo.GetTokenVersion(ctx, claims.Subject)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to get token version", "error", err)
+		return "", err
+	}
+	claims.Version = version
+
+	now := time.Now()
+	if claims.ID == "" {
+		claims.ID = fmt.Sprintf("%d", now.UnixNano())
+	}
+	if claims.IssuedAt == nil {
+		claims.IssuedAt = jwt.NewNumericDate(now)
+	}
+	if claims.ExpiresAt == nil {
+		claims.ExpiresAt = jwt.NewNumericDate(now.Add(j.accessTTL))
+	}
+
+	accessToken, err := tokenFormat.Issue(ctx, claims)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to issue access token", "error", err)
+		return "", err
+	}
+
+	return accessToken, nil
+}
+
+func (j *JWTGeneratorImpl) RefreshTokenPair(ctx context.Context, tokenPair *models.TokenPair,
+	userInfo *models.UserInfo) (*models.TokenPair, error) {
+	ctx, span := tracer.Start(ctx, "JWTGenerator.RefreshTokenPair")
+	defer span.End()
+
+	newTokenPair, err := j.refreshTokenPair(ctx, tokenPair, userInfo)
+	if err != nil {
+		recordError(span, err)
+		j.auditor.Record(ctx, authEvent(audit.EventTokenRefreshed, models.OutcomeFailure, userInfo, err.Error()))
+		metrics.Rejected("refresh", err)
+	} else {
+		metrics.TokensRefreshed.Inc()
+	}
+
+	return newTokenPair, err
+}
+
+func (j *JWTGeneratorImpl) refreshTokenPair(ctx context.Context, tokenPair *models.TokenPair,
+	userInfo *models.UserInfo) (*models.TokenPair, error) {
+	claims, err := j.formats.Parse(tokenPair.Access)
+	if errors.Is(err, errors2.ErrInternalServerError) {
+		slog.ErrorContext(ctx, "Failed to parse access token", "error", err)
+
+		return nil, errors2.ErrInternalServerError
+	}
+	if err != nil || claims.ID == "" || claims.Subject == "" {
 		return nil, errors2.ErrInvalidAccessToken
 	}
-	claims := access.Claims.(jwt.MapClaims)
-	jti := claims["jti"].(string)
-	userInfo.ID = claims["sub"].(string)
+	jti := claims.ID
+	userInfo.ID = claims.Subject
+	userInfo.ClientID = claims.ClientID
+	// The new pair keeps the format of the one being refreshed.
+	userInfo.Format = j.formats.Detect(tokenPair.Access)
 
-	refreshData, err := j.repo.GetRefreshData(jti)
-	if err != nil || refreshData.Revoked {
+	refreshData, err := j.repo.GetRefreshData(ctx, jti)
+	if err != nil {
 		return nil, errors2.ErrRefreshNotFoundOrRevoked
 	}
+	// The new pair continues the session of the old one.
+	userInfo.SessionID = refreshData.SessionID
 
-	if userInfo.Agent != refreshData.UserAgent {
-		if err := j.repo.RevokeRefresh(jti); err != nil {
-			log.Errorf("Failed to revoke refresh: %v", err)
+	if refreshData.Revoked {
+		if validRefreshToken(ctx, refreshData, tokenPair.Refresh) {
+			j.reportReuse(ctx, userInfo)
 		}
 
+		return nil, errors2.ErrRefreshNotFoundOrRevoked
+	}
+
+	if userInfo.Agent != refreshData.UserAgent {
+		j.revokeOnUserAgentMismatch(ctx, jti, userInfo, refreshData)
+
 		return nil, errors2.ErrUserAgentChanged
 	}
 
-	sha := sha256.Sum256([]byte(tokenPair.Refresh))
-	hashed := hex.EncodeToString(sha[:])
-	err = bcrypt.CompareHashAndPassword([]byte(refreshData.Hash), []byte(hashed))
-	if err != nil {
-		return nil, errors2.ErrInvalidRefreshToken
+	// A refresh token bound to a DPoP key can only be used with a proof
+	// signed by the same key.
+	if refreshData.JKT != "" && userInfo.JKT != refreshData.JKT {
+		return nil, errors2.ErrDPoPKeyMismatch
+	}
+	// The same goes for refresh tokens bound to a client certificate.
+	if refreshData.X5T != "" && userInfo.X5T != refreshData.X5T {
+		return nil, errors2.ErrCertificateMismatch
 	}
 
-	if userInfo.IP != refreshData.IP {
-		go j.notifyWebhook(refreshData.UserID, userInfo.IP)
+	if !validRefreshToken(ctx, refreshData, tokenPair.Refresh) {
+		return nil, errors2.ErrInvalidRefreshToken
 	}
 
-	tx, err := j.repo.BeginTx()
+	tx, err := j.repo.BeginTx(ctx)
 	if err != nil {
-		log.Errorf("failed to start tx")
+		slog.ErrorContext(ctx, "failed to start tx", "error", err)
 		return nil, err
 	}
-	defer tx.Rollback(context.Background())
+	defer tx.Rollback(ctx)
 
-	err = j.repo.RevokeRefreshTx(tx, jti)
+	// The token was read outside the transaction, it may have been
+	// refreshed since by a concurrent request.
+	err = j.repo.RevokeRefreshTx(ctx, tx, jti)
+	if errors.Is(err, errors2.ErrInvalidToken) {
+		return nil, errors2.ErrRefreshNotFoundOrRevoked
+	}
 	if err != nil {
-		log.Errorf("Failed to revoke refresh: %v", err)
+		slog.ErrorContext(ctx, "Failed to revoke refresh", "error", err)
 
 		return nil, errors2.ErrInternalServerError
 	}
 
-	newTokenPair, err := j.GenerateTokenPair(userInfo)
+	newTokenPair, err := j.generateTokenPairTx(ctx, tx, userInfo)
 	if err != nil {
-		log.Errorf("Failed to generate new token pair: %v", err)
+		slog.ErrorContext(ctx, "Failed to generate new token pair", "error", err)
 
 		return nil, errors2.ErrInternalServerError
 	}
 
-	if err = tx.Commit(context.Background()); err != nil {
-		log.Errorf("Tx commit failed: %v", err)
+	err = j.publisher.PublishTx(ctx, tx, outbox.EventTokenRefreshed, userInfo.ID, sessionEvent(userInfo))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to publish event", "error", err)
+
+		return nil, errors2.ErrInternalServerError
+	}
+
+	if userInfo.IP != refreshData.IP {
+		event := sessionEvent(userInfo)
+		event["previous_ip"] = refreshData.IP
+		err = j.publisher.PublishTx(ctx, tx, outbox.EventIPChanged, userInfo.ID, event)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to publish event", "error", err)
+
+			return nil, errors2.ErrInternalServerError
+		}
+	}
+
+	err = j.auditor.RecordTx(ctx, tx, authEvent(audit.EventTokenRefreshed, models.OutcomeSuccess, userInfo, ""))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to record audit event", "error", err)
+
+		return nil, errors2.ErrInternalServerError
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		slog.ErrorContext(ctx, "Tx commit failed", "error", err)
 
 		return nil, err
 	}
@@ -172,18 +372,120 @@ func (j *JWTGeneratorImpl) RefreshTokenPair(ctx context.Context, tokenPair *mode
 	return newTokenPair, nil
 }
 
-func (j *JWTGeneratorImpl) notifyWebhook(userID string, userIP string) {
-	payload, _ := json.Marshal(map[string]string{
-		"user_id": userID,
-		"ip":      userIP,
-	})
+// revokeOnUserAgentMismatch revokes a refresh token presented from another
+// user agent than it was issued to, which suggests it was stolen.
+func (j *JWTGeneratorImpl) revokeOnUserAgentMismatch(ctx context.Context, jti string, userInfo *models.UserInfo,
+	refreshData *models.RefreshData) {
+	tx, err := j.repo.BeginTx(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to start tx", "error", err)
+		return
+	}
+	defer tx.Rollback(ctx)
 
-	resp, err := http.Post(j.webhookUrl, "application/json", bytes.NewReader(payload))
+	if err = j.repo.RevokeRefreshTx(ctx, tx, jti); err != nil {
+		// Already revoked by a concurrent request.
+		if !errors.Is(err, errors2.ErrInvalidToken) {
+			slog.ErrorContext(ctx, "Failed to revoke refresh", "error", err)
+		}
+		return
+	}
+
+	event := sessionEvent(userInfo)
+	event["expected_user_agent"] = refreshData.UserAgent
+	if err = j.publisher.PublishTx(ctx, tx, outbox.EventUserAgentMismatch, userInfo.ID, event); err != nil {
+		slog.ErrorContext(ctx, "Failed to publish event", "error", err)
+		return
+	}
+
+	err = j.auditor.RecordTx(ctx, tx, authEvent(audit.EventTokenRevoked, models.OutcomeSuccess, userInfo,
+		errors2.ErrUserAgentChanged.Error()))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to record audit event", "error", err)
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		slog.ErrorContext(ctx, "Tx commit failed", "error", err)
+	}
+}
+
+// reportReuse publishes an event about a revoked refresh token presented
+// again, either by its owner or by whoever stole it.
+func (j *JWTGeneratorImpl) reportReuse(ctx context.Context, userInfo *models.UserInfo) {
+	tx, err := j.repo.BeginTx(ctx)
 	if err != nil {
-		log.Errorf("Failet to notify webhook: %v", err)
+		slog.ErrorContext(ctx, "failed to start tx", "error", err)
+		return
+	}
+	defer tx.Rollback(ctx)
 
+	if err = j.publisher.PublishTx(ctx, tx, outbox.EventReuseDetected, userInfo.ID, sessionEvent(userInfo)); err != nil {
+		slog.ErrorContext(ctx, "Failed to publish event", "error", err)
 		return
 	}
 
-	log.Infof("Notify success. Status: %v, Code: %v", resp.Status, resp.StatusCode)
+	err = j.auditor.RecordTx(ctx, tx, authEvent(audit.EventTokenReused, models.OutcomeFailure, userInfo,
+		"revoked refresh token presented"))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to record audit event", "error", err)
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		slog.ErrorContext(ctx, "Tx commit failed", "error", err)
+	}
+}
+
+func validRefreshToken(ctx context.Context, refreshData *models.RefreshData, refreshToken string) bool {
+	sha := sha256.Sum256([]byte(refreshToken))
+	hashed := hex.EncodeToString(sha[:])
+
+	_, span := tracer.Start(ctx, "bcrypt.CompareHashAndPassword")
+	defer span.End()
+	defer metrics.ObserveBcrypt("compare", time.Now())
+
+	return bcrypt.CompareHashAndPassword([]byte(refreshData.Hash), []byte(hashed)) == nil
+}
+
+func hashRefreshToken(ctx context.Context, hashed string) ([]byte, error) {
+	_, span := tracer.Start(ctx, "bcrypt.GenerateFromPassword")
+	defer span.End()
+	defer metrics.ObserveBcrypt("hash", time.Now())
+
+	return bcrypt.GenerateFromPassword([]byte(hashed), bcrypt.DefaultCost)
+}
+
+// recordError marks span as failed, unless err is a rejection of the
+// client's tokens rather than a failure of the service.
+func recordError(span trace.Span, err error) {
+	span.RecordError(err)
+	if errors.Is(err, errors2.ErrInternalServerError) {
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// sessionEvent returns the data of events about the session of userInfo.
+func sessionEvent(userInfo *models.UserInfo) map[string]string {
+	return map[string]string{
+		"user_id":    userInfo.ID,
+		"session_id": userInfo.SessionID,
+		"client_id":  userInfo.ClientID,
+		"ip":         userInfo.IP,
+		"user_agent": userInfo.Agent,
+	}
+}
+
+func authEvent(eventType, outcome string, userInfo *models.UserInfo, reason string) models.AuthEvent {
+	return models.AuthEvent{
+		EventType: eventType,
+		Outcome:   outcome,
+		Actor:     audit.UserActor(userInfo.ID, userInfo.ClientID),
+		Subject:   userInfo.ID,
+		ClientID:  userInfo.ClientID,
+		SessionID: userInfo.SessionID,
+		IP:        userInfo.IP,
+		UserAgent: userInfo.Agent,
+		Reason:    reason,
+	}
 }
@@ -0,0 +1,102 @@
+package jwt_verifier
+
+import (
+	"context"
+	"errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	errors2 "jwt-service/internal/errors"
+	"jwt-service/internal/metrics"
+	"jwt-service/internal/models"
+	"jwt-service/internal/repository"
+	kill_switch "jwt-service/internal/services/kill-switch"
+	token_format "jwt-service/internal/services/token-format"
+	token_version "jwt-service/internal/services/token-version"
+	"log/slog"
+)
+
+var tracer = otel.Tracer("jwt-service/internal/services/jwt-verifier")
+
+type JWTVerifier interface {
+	// Verify checks the signature, expiry and revocation of an access token,
+	// by the kill switch, blacklist or token version, and returns its claims.
+	Verify(ctx context.Context, tokenStr string) (*models.AccessClaims, error)
+}
+
+type JWTVerifierImpl struct {
+	repo       repository.JWTRepository
+	formats    *token_format.Formats
+	versions   token_version.TokenVersions
+	killSwitch kill_switch.KillSwitch
+}
+
+func New(repo repository.JWTRepository, formats *token_format.Formats,
+	versions token_version.TokenVersions, killSwitch kill_switch.KillSwitch) *JWTVerifierImpl {
+	return &JWTVerifierImpl{
+		repo:       repo,
+		formats:    formats,
+		versions:   versions,
+		killSwitch: killSwitch,
+	}
+}
+
+func (v *JWTVerifierImpl) Verify(ctx context.Context, tokenStr string) (*models.AccessClaims, error) {
+	ctx, span := tracer.Start(ctx, "JWTVerifier.Verify")
+	defer span.End()
+
+	claims, err := v.verify(ctx, tokenStr)
+	if err != nil {
+		span.RecordError(err)
+		if errors.Is(err, errors2.ErrInternalServerError) {
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+
+	return claims, err
+}
+
+func (v *JWTVerifierImpl) verify(ctx context.Context, tokenStr string) (*models.AccessClaims, error) {
+	claims, err := v.formats.Parse(tokenStr)
+	if errors.Is(err, errors2.ErrInternalServerError) {
+		slog.ErrorContext(ctx, "Failed to parse access token", "error", err)
+
+		return nil, errors2.ErrInternalServerError
+	}
+	if err != nil || claims.ID == "" || claims.Subject == "" {
+		return nil, errors2.ErrInvalidToken
+	}
+
+	notBefore, err := v.killSwitch.NotBefore(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get token not-before time", "error", err)
+
+		return nil, errors2.ErrInternalServerError
+	}
+	if !notBefore.IsZero() && (claims.IssuedAt == nil || claims.IssuedAt.Before(notBefore)) {
+		return nil, errors2.ErrTokenRevoked
+	}
+
+	exist, err := v.repo.IsJWTBlacklisted(ctx, claims.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to check JWT blacklist", "error", err)
+
+		return nil, errors2.ErrInternalServerError
+	}
+	if exist {
+		metrics.BlacklistLookups.WithLabelValues("hit").Inc()
+		return nil, errors2.ErrTokenRevoked
+	}
+	metrics.BlacklistLookups.WithLabelValues("miss").Inc()
+
+	version, err := v.versions.Current(ctx, claims.Subject)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get token version", "error", err)
+
+		return nil, errors2.ErrInternalServerError
+	}
+	if claims.Version < version {
+		return nil, errors2.ErrTokenRevoked
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,187 @@
+package kill_switch
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	errors2 "jwt-service/internal/errors"
+	"jwt-service/internal/models"
+	"jwt-service/internal/repository"
+	"jwt-service/internal/services/audit"
+	"jwt-service/internal/services/outbox"
+	token_format "jwt-service/internal/services/token-format"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	ActionKillSwitch = "kill_switch"
+
+	// cacheTTL bounds how long another instance of the service may keep
+	// accepting tokens issued before the kill switch was triggered.
+	cacheTTL = 5 * time.Second
+
+	signingKeySize = 64
+)
+
+type KillSwitch interface {
+	// NotBefore returns the time before which access tokens are rejected,
+	// cached for a short while.
+	NotBefore(ctx context.Context) (time.Time, error)
+	// Trigger invalidates every token issued so far: access tokens by the
+	// not-before time and a signing key rotation, refresh tokens by
+	// revoking them. The action is recorded in the admin audit trail.
+	// Only the HS512 key is rotated, the configured PASETO and JWE keys
+	// are listed in the response to be replaced by hand.
+	Trigger(ctx context.Context, actor, reason string) (*models.KillSwitchResponse, error)
+}
+
+type KillSwitchImpl struct {
+	repo      repository.SecurityRepository
+	formats   *token_format.Formats
+	publisher outbox.Publisher
+	auditor   audit.Auditor
+
+	mu        sync.Mutex
+	notBefore time.Time
+	expiresAt time.Time
+}
+
+func New(repo repository.SecurityRepository, formats *token_format.Formats,
+	publisher outbox.Publisher, auditor audit.Auditor) *KillSwitchImpl {
+	return &KillSwitchImpl{
+		repo:      repo,
+		formats:   formats,
+		publisher: publisher,
+		auditor:   auditor,
+	}
+}
+
+func (k *KillSwitchImpl) NotBefore(ctx context.Context) (time.Time, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if time.Now().Before(k.expiresAt) {
+		return k.notBefore, nil
+	}
+
+	notBefore, err := k.repo.GetTokenNotBefore(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	k.notBefore = notBefore
+	k.expiresAt = time.Now().Add(cacheTTL)
+
+	return notBefore, nil
+}
+
+func (k *KillSwitchImpl) Trigger(ctx context.Context, actor, reason string) (*models.KillSwitchResponse, error) {
+	if reason == "" {
+		return nil, errors2.ErrReasonRequired
+	}
+
+	// iat has a precision of a second, tokens issued later within the same
+	// second must not be rejected. Refresh tokens are revoked precisely.
+	triggeredAt := time.Now()
+	now := triggeredAt.Truncate(time.Second)
+	key, err := newSigningKey(now)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := k.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err = k.repo.SetTokenNotBeforeTx(ctx, tx, now); err != nil {
+		return nil, err
+	}
+
+	revoked, err := k.repo.RevokeRefreshIssuedBeforeTx(ctx, tx, triggeredAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = k.repo.RotateSigningKeyTx(ctx, tx, key); err != nil {
+		return nil, err
+	}
+
+	resp := &models.KillSwitchResponse{
+		NotBefore:            now,
+		RevokedRefreshTokens: revoked,
+		KeyID:                key.KID,
+		RotateManually:       k.formats.StaticKeys(),
+	}
+	details, err := json.Marshal(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	action := models.AdminAction{
+		Action:  ActionKillSwitch,
+		Actor:   actor,
+		Reason:  reason,
+		Details: details,
+	}
+	if err = k.repo.SaveAdminActionTx(ctx, tx, action); err != nil {
+		return nil, err
+	}
+
+	err = k.publisher.PublishTx(ctx, tx, outbox.EventKeyRotated, "", map[string]any{
+		"key_id":     key.KID,
+		"not_before": now,
+		"actor":      actor,
+		"reason":     reason,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = k.auditor.RecordTx(ctx, tx, audit.AdminEvent(action)); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	k.mu.Lock()
+	k.notBefore = now
+	k.expiresAt = time.Now().Add(cacheTTL)
+	k.mu.Unlock()
+
+	if err = k.formats.ReloadKeys(ctx); err != nil {
+		// Other instances pick the new key up on their own, so will this one.
+		slog.ErrorContext(ctx, "Failed to reload signing keys", "error", err)
+	}
+
+	slog.WarnContext(ctx, "Kill switch triggered", "actor", actor, "reason", reason)
+	if len(resp.RotateManually) > 0 {
+		slog.WarnContext(ctx, "Keys not rotated by the kill switch can still issue tokens, replace them",
+			"keys", resp.RotateManually)
+	}
+
+	return resp, nil
+}
+
+func newSigningKey(createdAt time.Time) (models.SigningKey, error) {
+	secret := make([]byte, signingKeySize)
+	if _, err := rand.Read(secret); err != nil {
+		return models.SigningKey{}, err
+	}
+
+	kid := make([]byte, 16)
+	if _, err := rand.Read(kid); err != nil {
+		return models.SigningKey{}, err
+	}
+
+	return models.SigningKey{
+		KID:       base64.RawURLEncoding.EncodeToString(kid),
+		Secret:    secret,
+		CreatedAt: createdAt,
+	}, nil
+}
@@ -0,0 +1,44 @@
+package mtls
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+)
+
+const (
+	// ClientAuthRequest asks clients for a certificate and verifies it if one
+	// is presented. ClientAuthRequire rejects connections without one.
+	ClientAuthRequest = "request"
+	ClientAuthRequire = "require"
+)
+
+// CertificateThumbprint returns the base64url-encoded SHA-256 hash of the
+// client certificate of a TLS connection, as used by the x5t#S256
+// confirmation method (RFC 8705, section 3.1). It returns an empty string
+// for plain connections and connections without a client certificate.
+func CertificateThumbprint(state *tls.ConnectionState) string {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return ""
+	}
+
+	sum := sha256.Sum256(state.PeerCertificates[0].Raw)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ClientAuth returns a function that sets the client authentication policy
+// of the server's TLS config according to mode.
+func ClientAuth(mode string) func(*tls.Config) {
+	return func(tlsConfig *tls.Config) {
+		if tlsConfig.ClientCAs == nil {
+			return
+		}
+
+		if mode == ClientAuthRequire {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		} else {
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+}
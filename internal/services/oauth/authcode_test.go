@@ -0,0 +1,136 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	errors2 "jwt-service/internal/errors"
+	"jwt-service/internal/models"
+	"jwt-service/internal/repository"
+	jwt_generator "jwt-service/internal/services/jwt-generator"
+	"jwt-service/internal/services/sessions"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r7wW1gFWFOEjXk"
+
+// codeRepo holds a single authorization code.
+type codeRepo struct {
+	repository.OAuthRepository
+	code models.AuthCode
+}
+
+func (r *codeRepo) ConsumeAuthCode(ctx context.Context, codeHash, sessionID string) (*models.AuthCode, error) {
+	code := r.code
+	if !r.code.Used {
+		r.code.Used, r.code.SessionID = true, sessionID
+	}
+
+	return &code, nil
+}
+
+// sessionIssuer records the session of the token pair issued last.
+type sessionIssuer struct {
+	jwt_generator.JWTGenerator
+	sessionID string
+}
+
+func (g *sessionIssuer) GenerateTokenPair(ctx context.Context, info *models.UserInfo) (*models.TokenPair, error) {
+	g.sessionID = info.SessionID
+
+	return &models.TokenPair{Access: "access"}, nil
+}
+
+// revokedSessions records the sessions revoked.
+type revokedSessions struct {
+	sessions.SessionService
+	revoked []string
+}
+
+func (s *revokedSessions) Revoke(ctx context.Context, userID, sessionID, ip, userAgent string) error {
+	s.revoked = append(s.revoked, sessionID)
+
+	return nil
+}
+
+func newCodeService(redirectURI string) (*OAuthServiceImpl, *sessionIssuer, *revokedSessions) {
+	sum := sha256.Sum256([]byte(testVerifier))
+	generator, revoked := &sessionIssuer{}, &revokedSessions{}
+
+	return &OAuthServiceImpl{
+		repo: &codeRepo{code: models.AuthCode{
+			ClientID:      "app",
+			UserID:        "user-1",
+			RedirectURI:   redirectURI,
+			CodeChallenge: base64.RawURLEncoding.EncodeToString(sum[:]),
+			ExpiresAt:     time.Now().Add(time.Minute),
+		}},
+		generator: generator,
+		sessions:  revoked,
+	}, generator, revoked
+}
+
+var publicClient = &models.OAuthClient{ID: "app", RedirectURIs: []string{"https://app/cb", "https://app/other"}}
+
+func codeRequest(redirectURI string) *models.TokenRequest {
+	return &models.TokenRequest{
+		GrantType:    GrantTypeAuthorizationCode,
+		Code:         "code",
+		RedirectURI:  redirectURI,
+		CodeVerifier: testVerifier,
+	}
+}
+
+func TestExchangeAuthCodeRedirectURI(t *testing.T) {
+	tests := []struct {
+		name      string
+		authorize string
+		token     string
+		wantErr   error
+	}{
+		{name: "sent to both", authorize: "https://app/cb", token: "https://app/cb"},
+		{name: "omitted from both"},
+		{name: "omitted from the token request", authorize: "https://app/cb",
+			wantErr: errors2.ErrOAuthInvalidGrant},
+		{name: "another one in the token request", authorize: "https://app/cb", token: "https://app/other",
+			wantErr: errors2.ErrOAuthInvalidGrant},
+		{name: "registered one sent only to the token endpoint", token: "https://app/other"},
+		{name: "unregistered one sent only to the token endpoint", token: "https://evil/cb",
+			wantErr: errors2.ErrOAuthInvalidGrant},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, _, _ := newCodeService(tt.authorize)
+
+			_, err := o.exchangeAuthCode(context.Background(), codeRequest(tt.token), publicClient,
+				&models.UserInfo{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExchangeAuthCodeReplay(t *testing.T) {
+	o, generator, revoked := newCodeService("")
+
+	if _, err := o.exchangeAuthCode(context.Background(), codeRequest(""), publicClient,
+		&models.UserInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	if generator.sessionID == "" {
+		t.Fatal("the tokens were issued without a session")
+	}
+
+	_, err := o.exchangeAuthCode(context.Background(), codeRequest(""), publicClient, &models.UserInfo{})
+	if !errors.Is(err, errors2.ErrOAuthInvalidGrant) || !strings.Contains(err.Error(), "already used") {
+		t.Fatalf("error %v, want a replay", err)
+	}
+	if len(revoked.revoked) != 1 || revoked.revoked[0] != generator.sessionID {
+		t.Errorf("revoked %v, want the session %s", revoked.revoked, generator.sessionID)
+	}
+}
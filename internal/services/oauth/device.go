@@ -0,0 +1,228 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	errors2 "jwt-service/internal/errors"
+	"jwt-service/internal/models"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	devicePollInterval = 5
+	// slowDownStep is the number of seconds added to the polling interval
+	// every time a client polls too fast (RFC 8628, section 3.5).
+	slowDownStep = 5
+
+	// userCodeAlphabet has no vowels, to avoid accidental words, and no
+	// characters that are easy to confuse (RFC 8628, section 6.1).
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+
+	GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+func (o *OAuthServiceImpl) DeviceAuthorization(ctx context.Context,
+	req *models.DeviceAuthorizationRequest) (*models.DeviceAuthorizationResponse, error) {
+	client, err := o.repo.GetClient(ctx, req.ClientID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: unknown client", errors2.ErrOAuthInvalidClient)
+		}
+		slog.ErrorContext(ctx, "Failed to get oauth client", "error", err)
+
+		return nil, errors2.ErrOAuthServerError
+	}
+
+	deviceCode, err := randomToken()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to generate device code", "error", err)
+
+		return nil, errors2.ErrOAuthServerError
+	}
+	userCode, err := randomUserCode()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to generate user code", "error", err)
+
+		return nil, errors2.ErrOAuthServerError
+	}
+
+	err = o.repo.SaveDeviceCode(ctx, models.DeviceCode{
+		DeviceCodeHash: hashCode(deviceCode),
+		UserCode:       userCode,
+		ClientID:       client.ID,
+		Status:         models.DeviceCodePending,
+		Interval:       devicePollInterval,
+		ExpiresAt:      time.Now().Add(o.deviceCodeTTL),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to save device code", "error", err)
+
+		return nil, errors2.ErrOAuthServerError
+	}
+
+	display := formatUserCode(userCode)
+
+	return &models.DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                display,
+		VerificationURI:         o.verificationURI,
+		VerificationURIComplete: appendQuery(o.verificationURI, url.Values{"user_code": {display}}),
+		ExpiresIn:               int64(o.deviceCodeTTL.Seconds()),
+		Interval:                devicePollInterval,
+	}, nil
+}
+
+func (o *OAuthServiceImpl) GetDeviceVerification(ctx context.Context,
+	userCode string) (*models.DeviceVerificationResponse, error) {
+	code, err := o.repo.GetDeviceCodeByUserCode(ctx, normalizeUserCode(userCode))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors2.ErrUserCodeNotFound
+		}
+		slog.ErrorContext(ctx, "Failed to get device code", "error", err)
+
+		return nil, errors2.ErrInternalServerError
+	}
+	if code.Status != models.DeviceCodePending || time.Now().After(code.ExpiresAt) {
+		return nil, errors2.ErrUserCodeNotFound
+	}
+
+	client, err := o.repo.GetClient(ctx, code.ClientID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get oauth client", "error", err)
+
+		return nil, errors2.ErrInternalServerError
+	}
+
+	return &models.DeviceVerificationResponse{
+		UserCode:   formatUserCode(code.UserCode),
+		ClientID:   client.ID,
+		ClientName: client.Name,
+		ExpiresAt:  code.ExpiresAt,
+	}, nil
+}
+
+func (o *OAuthServiceImpl) VerifyDevice(ctx context.Context, req *models.DeviceVerificationRequest, userID string) error {
+	status := models.DeviceCodeDenied
+	if req.Approve {
+		status = models.DeviceCodeApproved
+	}
+
+	ok, err := o.repo.ResolveDeviceCode(ctx, normalizeUserCode(req.UserCode), userID, status)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to resolve device code", "error", err)
+
+		return errors2.ErrInternalServerError
+	}
+	if !ok {
+		return errors2.ErrUserCodeNotFound
+	}
+
+	return nil
+}
+
+func (o *OAuthServiceImpl) exchangeDeviceCode(ctx context.Context, req *models.TokenRequest, client *models.OAuthClient,
+	info *models.UserInfo) (*models.TokenPair, error) {
+	if req.DeviceCode == "" {
+		return nil, fmt.Errorf("%w: missing device_code", errors2.ErrOAuthInvalidRequest)
+	}
+
+	code, err := o.repo.PollDeviceCode(ctx, hashCode(req.DeviceCode))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: unknown device code", errors2.ErrOAuthInvalidGrant)
+		}
+		slog.ErrorContext(ctx, "Failed to poll device code", "error", err)
+
+		return nil, errors2.ErrOAuthServerError
+	}
+
+	if code.ClientID != client.ID {
+		return nil, fmt.Errorf("%w: device code was issued to another client", errors2.ErrOAuthInvalidGrant)
+	}
+	if time.Now().After(code.ExpiresAt) {
+		return nil, errors2.ErrOAuthExpiredToken
+	}
+
+	switch code.Status {
+	case models.DeviceCodeDenied:
+		return nil, errors2.ErrOAuthAccessDenied
+	case models.DeviceCodeConsumed:
+		return nil, fmt.Errorf("%w: device code already used", errors2.ErrOAuthInvalidGrant)
+	case models.DeviceCodePending:
+		interval := time.Duration(code.Interval) * time.Second
+		if code.LastPolledAt != nil && time.Since(*code.LastPolledAt) < interval {
+			if err = o.repo.SetDeviceCodeInterval(ctx, code.DeviceCodeHash, code.Interval+slowDownStep); err != nil {
+				slog.ErrorContext(ctx, "Failed to update device code interval", "error", err)
+			}
+
+			return nil, errors2.ErrOAuthSlowDown
+		}
+
+		return nil, errors2.ErrOAuthAuthorizationPending
+	}
+
+	ok, err := o.repo.ConsumeDeviceCode(ctx, code.DeviceCodeHash)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to consume device code", "error", err)
+
+		return nil, errors2.ErrOAuthServerError
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: device code already used", errors2.ErrOAuthInvalidGrant)
+	}
+
+	info.ID = code.UserID
+	info.ClientID = client.ID
+	info.Format = client.TokenFormat
+	tokenPair, err := o.generator.GenerateTokenPair(ctx, info)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to generate token pair", "error", err)
+
+		return nil, errors2.ErrOAuthServerError
+	}
+
+	return tokenPair, nil
+}
+
+func randomUserCode() (string, error) {
+	b := make([]byte, userCodeLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	// 256 is not a multiple of the alphabet size, but the bias is small and
+	// user codes only need to withstand guessing for their short lifetime.
+	for i := range b {
+		b[i] = userCodeAlphabet[int(b[i])%len(userCodeAlphabet)]
+	}
+
+	return string(b), nil
+}
+
+// normalizeUserCode makes user input comparable with stored user codes:
+// case, dashes and spaces are ignored.
+func normalizeUserCode(userCode string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+
+		return r
+	}, strings.ToUpper(userCode))
+}
+
+func formatUserCode(userCode string) string {
+	if len(userCode) != userCodeLength {
+		return userCode
+	}
+
+	return userCode[:userCodeLength/2] + "-" + userCode[userCodeLength/2:]
+}
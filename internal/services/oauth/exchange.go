@@ -0,0 +1,165 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	errors2 "jwt-service/internal/errors"
+	"jwt-service/internal/models"
+	jwt_generator "jwt-service/internal/services/jwt-generator"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeJWT         = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// exchangeToken implements the token exchange grant (RFC 8693). It issues an
+// access token for the subject of the subject token, restricted to a single
+// audience and to the scopes both allowed by the client's policy for it and
+// held by the subject token. The acting party, the actor token's subject or
+// the client itself, is recorded in the act claim on top of any delegation
+// chain the subject token carries. Subject and actor tokens bound to a key
+// are only exchanged by a client that proves possession of it, so a stolen
+// bound token cannot be turned into an unbound one.
+func (o *OAuthServiceImpl) exchangeToken(ctx context.Context, req *models.TokenRequest, client *models.OAuthClient,
+	info *models.UserInfo) (*models.OAuthTokenResponse, error) {
+	if client.SecretHash == "" {
+		return nil, fmt.Errorf("%w: token exchange requires a confidential client", errors2.ErrOAuthUnauthorizedClient)
+	}
+
+	switch {
+	case req.SubjectToken == "" || req.SubjectTokenType == "":
+		return nil, fmt.Errorf("%w: subject_token and subject_token_type are required", errors2.ErrOAuthInvalidRequest)
+	case !isAccessTokenType(req.SubjectTokenType):
+		return nil, fmt.Errorf("%w: unsupported subject_token_type", errors2.ErrOAuthInvalidRequest)
+	case req.ActorToken != "" && !isAccessTokenType(req.ActorTokenType):
+		return nil, fmt.Errorf("%w: unsupported actor_token_type", errors2.ErrOAuthInvalidRequest)
+	case req.RequestedTokenType != "" && req.RequestedTokenType != TokenTypeAccessToken:
+		return nil, fmt.Errorf("%w: unsupported requested_token_type", errors2.ErrOAuthInvalidRequest)
+	case req.Audience == "":
+		return nil, fmt.Errorf("%w: missing audience", errors2.ErrOAuthInvalidRequest)
+	}
+
+	policy, err := o.repo.GetExchangePolicy(ctx, client.ID, req.Audience)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: audience is not allowed for this client", errors2.ErrOAuthInvalidTarget)
+		}
+		slog.ErrorContext(ctx, "Failed to get token exchange policy", "error", err)
+
+		return nil, errors2.ErrOAuthServerError
+	}
+
+	subject, err := o.verifier.Verify(ctx, req.SubjectToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid subject_token", errors2.ErrOAuthInvalidGrant)
+	}
+	if !boundTo(subject.Cnf, info) {
+		return nil, fmt.Errorf("%w: subject_token is bound to a key the client did not prove possession of",
+			errors2.ErrOAuthInvalidGrant)
+	}
+
+	act := &models.Actor{Subject: client.ID, Act: subject.Act}
+	if req.ActorToken != "" {
+		actor, err := o.verifier.Verify(ctx, req.ActorToken)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid actor_token", errors2.ErrOAuthInvalidGrant)
+		}
+		if !boundTo(actor.Cnf, info) {
+			return nil, fmt.Errorf("%w: actor_token is bound to a key the client did not prove possession of",
+				errors2.ErrOAuthInvalidGrant)
+		}
+		act.Subject = actor.Subject
+	} else if policy.ActorRequired {
+		return nil, fmt.Errorf("%w: actor_token is required for this audience", errors2.ErrOAuthInvalidRequest)
+	}
+
+	scopes, err := grantScopes(strings.Fields(req.Scope), policy.Scopes, subject.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(time.Duration(policy.MaxTTLSeconds) * time.Second)
+	if subject.ExpiresAt.Before(expiresAt) {
+		expiresAt = subject.ExpiresAt.Time
+	}
+
+	claims := &models.AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject.Subject,
+			Audience:  jwt.ClaimStrings{policy.Audience},
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		Scope:    strings.Join(scopes, " "),
+		ClientID: client.ID,
+		Act:      act,
+	}
+	if info.JKT != "" || info.X5T != "" {
+		claims.Cnf = &models.Confirmation{JKT: info.JKT, X5TS256: info.X5T}
+	}
+
+	accessToken, err := o.generator.IssueAccessToken(ctx, claims, client.TokenFormat)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to issue exchanged token", "error", err)
+
+		return nil, errors2.ErrOAuthServerError
+	}
+
+	return &models.OAuthTokenResponse{
+		AccessToken:     accessToken,
+		IssuedTokenType: TokenTypeAccessToken,
+		TokenType:       tokenType(info),
+		ExpiresIn:       int64(time.Until(expiresAt).Seconds()),
+		Scope:           strings.Join(scopes, " "),
+	}, nil
+}
+
+// grantScopes narrows the requested scopes to those allowed by the policy and
+// held by the subject token. Tokens issued to users carry no scopes but the
+// full authority of the user, so for a subject token without scopes other
+// than admin the policy alone decides. The admin scope is never granted, as
+// tokens of OAuth clients must not reach the admin API. An empty request is
+// granted everything that is allowed.
+func grantScopes(requested, allowed []string, subjectScope string) ([]string, error) {
+	subjectScopes := slices.DeleteFunc(strings.Fields(subjectScope), func(s string) bool {
+		return s == jwt_generator.ScopeAdmin
+	})
+	allowed = slices.DeleteFunc(slices.Clone(allowed), func(s string) bool {
+		return s == jwt_generator.ScopeAdmin || len(subjectScopes) > 0 && !slices.Contains(subjectScopes, s)
+	})
+
+	if len(requested) == 0 {
+		return allowed, nil
+	}
+	for _, s := range requested {
+		if !slices.Contains(allowed, s) {
+			return nil, fmt.Errorf("%w: scope %q is not allowed", errors2.ErrOAuthInvalidScope, s)
+		}
+	}
+
+	return requested, nil
+}
+
+// boundTo reports whether the client of a token request, identified by info,
+// holds the keys cnf binds a token to: the DPoP key of its proof and the
+// certificate of its TLS connection.
+func boundTo(cnf *models.Confirmation, info *models.UserInfo) bool {
+	if cnf == nil {
+		return true
+	}
+
+	return (cnf.JKT == "" || cnf.JKT == info.JKT) && (cnf.X5TS256 == "" || cnf.X5TS256 == info.X5T)
+}
+
+func isAccessTokenType(tokenType string) bool {
+	return tokenType == TokenTypeAccessToken || tokenType == TokenTypeJWT
+}
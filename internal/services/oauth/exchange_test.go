@@ -0,0 +1,228 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	errors2 "jwt-service/internal/errors"
+	"jwt-service/internal/models"
+	"jwt-service/internal/repository"
+	jwt_generator "jwt-service/internal/services/jwt-generator"
+	"testing"
+	"time"
+)
+
+type exchangeRepo struct {
+	repository.OAuthRepository
+	policy models.ExchangePolicy
+}
+
+func (r *exchangeRepo) GetExchangePolicy(ctx context.Context, clientID, audience string) (*models.ExchangePolicy,
+	error) {
+	return &r.policy, nil
+}
+
+// tokenVerifier accepts the tokens it holds the claims of.
+type tokenVerifier map[string]*models.AccessClaims
+
+func (v tokenVerifier) Verify(ctx context.Context, tokenStr string) (*models.AccessClaims, error) {
+	claims, ok := v[tokenStr]
+	if !ok {
+		return nil, errors2.ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+// issuedClaims records the claims of the access token issued last.
+type issuedClaims struct {
+	jwt_generator.JWTGenerator
+	claims *models.AccessClaims
+}
+
+func (g *issuedClaims) IssueAccessToken(ctx context.Context, claims *models.AccessClaims,
+	format string) (string, error) {
+	g.claims = claims
+
+	return "exchanged", nil
+}
+
+func newExchangeService(scopes []string, tokens tokenVerifier) (*OAuthServiceImpl, *issuedClaims) {
+	generator := &issuedClaims{}
+
+	return &OAuthServiceImpl{
+		repo: &exchangeRepo{policy: models.ExchangePolicy{
+			ClientID:      "service-a",
+			Audience:      "service-b",
+			Scopes:        scopes,
+			MaxTTLSeconds: 300,
+		}},
+		generator: generator,
+		verifier:  tokens,
+	}, generator
+}
+
+func userToken(scope string, cnf *models.Confirmation) *models.AccessClaims {
+	return &models.AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "user-1",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		Scope: scope,
+		Cnf:   cnf,
+	}
+}
+
+func exchangeRequest(scope string) *models.TokenRequest {
+	return &models.TokenRequest{
+		GrantType:        GrantTypeTokenExchange,
+		SubjectToken:     "subject",
+		SubjectTokenType: TokenTypeAccessToken,
+		Audience:         "service-b",
+		Scope:            scope,
+	}
+}
+
+var confidentialClient = &models.OAuthClient{ID: "service-a", SecretHash: "bcrypt"}
+
+func TestExchangeTokenScopes(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       []string
+		subjectScope string
+		requested    string
+		want         string
+		wantErr      error
+	}{
+		{
+			name:   "user token gets the policy",
+			policy: []string{"orders:read", "orders:write"},
+			want:   "orders:read orders:write",
+		},
+		{
+			name:      "user token narrowed by the request",
+			policy:    []string{"orders:read", "orders:write"},
+			requested: "orders:read",
+			want:      "orders:read",
+		},
+		{
+			name:      "scope outside the policy",
+			policy:    []string{"orders:read"},
+			requested: "orders:write",
+			wantErr:   errors2.ErrOAuthInvalidScope,
+		},
+		{
+			name:         "scoped token narrows the policy",
+			policy:       []string{"orders:read", "orders:write"},
+			subjectScope: "orders:read profile",
+			want:         "orders:read",
+		},
+		{
+			name:         "scope the subject token does not hold",
+			policy:       []string{"orders:read", "orders:write"},
+			subjectScope: "orders:read",
+			requested:    "orders:write",
+			wantErr:      errors2.ErrOAuthInvalidScope,
+		},
+		{
+			name:         "admin token gets the policy without admin",
+			policy:       []string{"orders:read", jwt_generator.ScopeAdmin},
+			subjectScope: jwt_generator.ScopeAdmin,
+			want:         "orders:read",
+		},
+		{
+			name:         "admin is never granted",
+			policy:       []string{"orders:read", jwt_generator.ScopeAdmin},
+			subjectScope: jwt_generator.ScopeAdmin,
+			requested:    jwt_generator.ScopeAdmin,
+			wantErr:      errors2.ErrOAuthInvalidScope,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, generator := newExchangeService(tt.policy, tokenVerifier{"subject": userToken(tt.subjectScope, nil)})
+
+			resp, err := o.exchangeToken(context.Background(), exchangeRequest(tt.requested), confidentialClient,
+				&models.UserInfo{})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.Scope != tt.want || generator.claims.Scope != tt.want {
+				t.Errorf("granted %q in the response and %q in the token, want %q", resp.Scope,
+					generator.claims.Scope, tt.want)
+			}
+		})
+	}
+}
+
+func TestExchangeTokenBinding(t *testing.T) {
+	dpopBound := &models.Confirmation{JKT: "jkt-1"}
+	certBound := &models.Confirmation{X5TS256: "x5t-1"}
+
+	tests := []struct {
+		name       string
+		subjectCnf *models.Confirmation
+		actorCnf   *models.Confirmation
+		info       models.UserInfo
+		wantErr    bool
+	}{
+		{name: "unbound token", info: models.UserInfo{}},
+		{name: "unbound token exchanged with a DPoP key", info: models.UserInfo{JKT: "jkt-2"}},
+		{name: "DPoP-bound token with its key", subjectCnf: dpopBound, info: models.UserInfo{JKT: "jkt-1"}},
+		{name: "DPoP-bound token without a proof", subjectCnf: dpopBound, wantErr: true},
+		{name: "DPoP-bound token with another key", subjectCnf: dpopBound, info: models.UserInfo{JKT: "jkt-2"},
+			wantErr: true},
+		{name: "certificate-bound token with its certificate", subjectCnf: certBound,
+			info: models.UserInfo{X5T: "x5t-1"}},
+		{name: "certificate-bound token without a certificate", subjectCnf: certBound, wantErr: true},
+		{name: "certificate-bound token with another certificate", subjectCnf: certBound,
+			info: models.UserInfo{X5T: "x5t-2"}, wantErr: true},
+		{name: "bound actor token without its key", actorCnf: dpopBound, wantErr: true},
+		{name: "bound actor token with its key", actorCnf: dpopBound, info: models.UserInfo{JKT: "jkt-1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, generator := newExchangeService([]string{"orders:read"}, tokenVerifier{
+				"subject": userToken("", tt.subjectCnf),
+				"actor":   userToken("", tt.actorCnf),
+			})
+			req := exchangeRequest("")
+			req.ActorToken, req.ActorTokenType = "actor", TokenTypeAccessToken
+
+			_, err := o.exchangeToken(context.Background(), req, confidentialClient, &tt.info)
+			if tt.wantErr {
+				if !errors.Is(err, errors2.ErrOAuthInvalidGrant) {
+					t.Fatalf("error %v, want %v", err, errors2.ErrOAuthInvalidGrant)
+				}
+				if generator.claims != nil {
+					t.Error("a token was issued")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The exchanged token is bound to the keys of the client.
+			cnf := generator.claims.Cnf
+			if tt.info.JKT == "" && tt.info.X5T == "" {
+				if cnf != nil {
+					t.Errorf("cnf %+v, want none", cnf)
+				}
+				return
+			}
+			if cnf == nil || cnf.JKT != tt.info.JKT || cnf.X5TS256 != tt.info.X5T {
+				t.Errorf("cnf %+v, want jkt %q and x5t#S256 %q", cnf, tt.info.JKT, tt.info.X5T)
+			}
+		})
+	}
+}
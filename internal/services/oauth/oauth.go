@@ -0,0 +1,346 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+	"jwt-service/internal/config"
+	errors2 "jwt-service/internal/errors"
+	"jwt-service/internal/metrics"
+	"jwt-service/internal/models"
+	"jwt-service/internal/repository"
+	"jwt-service/internal/services/dpop"
+	jwt_generator "jwt-service/internal/services/jwt-generator"
+	jwt_verifier "jwt-service/internal/services/jwt-verifier"
+	"jwt-service/internal/services/sessions"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"slices"
+	"time"
+)
+
+const (
+	responseTypeCode    = "code"
+	challengeMethodS256 = "S256"
+
+	GrantTypeAuthorizationCode = "authorization_code"
+)
+
+// RFC 7636, section 4.1: 43-128 characters from the unreserved set.
+var codeVerifierRe = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+type OAuthService interface {
+	// Authorize validates an authorization request made on behalf of userID
+	// and returns the location the user agent must be redirected to.
+	Authorize(ctx context.Context, req *models.AuthorizeRequest, userID string) (string, error)
+	Token(ctx context.Context, req *models.TokenRequest, info *models.UserInfo) (*models.OAuthTokenResponse, error)
+
+	// DeviceAuthorization starts a device authorization grant (RFC 8628).
+	DeviceAuthorization(ctx context.Context,
+		req *models.DeviceAuthorizationRequest) (*models.DeviceAuthorizationResponse, error)
+	GetDeviceVerification(ctx context.Context, userCode string) (*models.DeviceVerificationResponse, error)
+	// VerifyDevice approves or denies a pending device authorization on
+	// behalf of userID.
+	VerifyDevice(ctx context.Context, req *models.DeviceVerificationRequest, userID string) error
+}
+
+type OAuthServiceImpl struct {
+	repo            repository.OAuthRepository
+	generator       jwt_generator.JWTGenerator
+	verifier        jwt_verifier.JWTVerifier
+	sessions        sessions.SessionService
+	verificationURI string
+	accessTTL       time.Duration
+	authCodeTTL     time.Duration
+	deviceCodeTTL   time.Duration
+}
+
+func New(repo repository.OAuthRepository, generator jwt_generator.JWTGenerator,
+	verifier jwt_verifier.JWTVerifier, sessions sessions.SessionService, cfg *config.Config) *OAuthServiceImpl {
+	return &OAuthServiceImpl{
+		repo:            repo,
+		generator:       generator,
+		verifier:        verifier,
+		sessions:        sessions,
+		verificationURI: cfg.DeviceVerificationURI,
+		accessTTL:       cfg.AccessTokenTTL,
+		authCodeTTL:     cfg.AuthCodeTTL,
+		deviceCodeTTL:   cfg.DeviceCodeTTL,
+	}
+}
+
+func (o *OAuthServiceImpl) Authorize(ctx context.Context, req *models.AuthorizeRequest, userID string) (string, error) {
+	client, err := o.repo.GetClient(ctx, req.ClientID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", fmt.Errorf("%w: unknown client", errors2.ErrOAuthInvalidClient)
+		}
+		slog.ErrorContext(ctx, "Failed to get oauth client", "error", err)
+
+		return "", errors2.ErrOAuthServerError
+	}
+
+	redirectURI, err := resolveRedirectURI(client, req.RedirectURI)
+	if err != nil {
+		return "", err
+	}
+
+	// From here on errors are reported to the client through the redirect URI.
+	switch {
+	case req.ResponseType != responseTypeCode:
+		return redirectWithError(redirectURI, req.State, errors2.ErrOAuthUnsupportedResponseType), nil
+	case req.CodeChallengeMethod != challengeMethodS256:
+		return redirectWithError(redirectURI, req.State, errors2.ErrOAuthInvalidRequest), nil
+	case !codeVerifierRe.MatchString(req.CodeChallenge):
+		return redirectWithError(redirectURI, req.State, errors2.ErrOAuthInvalidRequest), nil
+	}
+
+	code, err := randomToken()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to generate authorization code", "error", err)
+
+		return redirectWithError(redirectURI, req.State, errors2.ErrOAuthServerError), nil
+	}
+
+	err = o.repo.SaveAuthCode(ctx, models.AuthCode{
+		CodeHash:      hashCode(code),
+		ClientID:      client.ID,
+		UserID:        userID,
+		RedirectURI:   req.RedirectURI,
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     time.Now().Add(o.authCodeTTL),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to save authorization code", "error", err)
+
+		return redirectWithError(redirectURI, req.State, errors2.ErrOAuthServerError), nil
+	}
+
+	params := url.Values{}
+	params.Set("code", code)
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	return appendQuery(redirectURI, params), nil
+}
+
+func (o *OAuthServiceImpl) Token(ctx context.Context, req *models.TokenRequest,
+	info *models.UserInfo) (*models.OAuthTokenResponse, error) {
+	switch req.GrantType {
+	case GrantTypeAuthorizationCode, GrantTypeDeviceCode, GrantTypeTokenExchange:
+	case "":
+		return nil, fmt.Errorf("%w: missing grant_type", errors2.ErrOAuthInvalidRequest)
+	default:
+		return nil, errors2.ErrOAuthUnsupportedGrantType
+	}
+
+	client, err := o.authenticateClient(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var tokenPair *models.TokenPair
+	switch req.GrantType {
+	case GrantTypeAuthorizationCode:
+		tokenPair, err = o.exchangeAuthCode(ctx, req, client, info)
+	case GrantTypeDeviceCode:
+		tokenPair, err = o.exchangeDeviceCode(ctx, req, client, info)
+	case GrantTypeTokenExchange:
+		return o.exchangeToken(ctx, req, client, info)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.OAuthTokenResponse{
+		AccessToken:  tokenPair.Access,
+		TokenType:    tokenType(info),
+		ExpiresIn:    int64(o.accessTTL.Seconds()),
+		RefreshToken: tokenPair.Refresh,
+	}, nil
+}
+
+// authenticateClient looks up the client making a token request. Confidential
+// clients must present their secret, public clients only their ID.
+func (o *OAuthServiceImpl) authenticateClient(ctx context.Context, req *models.TokenRequest) (*models.OAuthClient, error) {
+	if req.ClientID == "" {
+		return nil, fmt.Errorf("%w: missing client_id", errors2.ErrOAuthInvalidRequest)
+	}
+
+	client, err := o.repo.GetClient(ctx, req.ClientID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: unknown client", errors2.ErrOAuthInvalidClient)
+		}
+		slog.ErrorContext(ctx, "Failed to get oauth client", "error", err)
+
+		return nil, errors2.ErrOAuthServerError
+	}
+
+	if client.SecretHash != "" && !validClientSecret(client.SecretHash, req.ClientSecret) {
+		return nil, fmt.Errorf("%w: client authentication failed", errors2.ErrOAuthInvalidClient)
+	}
+
+	return client, nil
+}
+
+func validClientSecret(hash, secret string) bool {
+	defer metrics.ObserveBcrypt("compare", time.Now())
+
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(secret)) == nil
+}
+
+// exchangeAuthCode implements the authorization code grant. redirect_uri is
+// required only if it was sent to the authorization endpoint (RFC 6749,
+// section 4.1.3). A code is consumed together with the session its tokens
+// are issued in, so that a replay revokes them (section 4.1.2).
+func (o *OAuthServiceImpl) exchangeAuthCode(ctx context.Context, req *models.TokenRequest, client *models.OAuthClient,
+	info *models.UserInfo) (*models.TokenPair, error) {
+	if req.Code == "" || req.CodeVerifier == "" {
+		return nil, fmt.Errorf("%w: code and code_verifier are required", errors2.ErrOAuthInvalidRequest)
+	}
+	if !codeVerifierRe.MatchString(req.CodeVerifier) {
+		return nil, fmt.Errorf("%w: malformed code_verifier", errors2.ErrOAuthInvalidRequest)
+	}
+
+	sessionID := uuid.NewString()
+	code, err := o.repo.ConsumeAuthCode(ctx, hashCode(req.Code), sessionID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: unknown authorization code", errors2.ErrOAuthInvalidGrant)
+		}
+		slog.ErrorContext(ctx, "Failed to consume authorization code", "error", err)
+
+		return nil, errors2.ErrOAuthServerError
+	}
+
+	switch {
+	case code.Used:
+		slog.WarnContext(ctx, "Authorization code replay, revoking the tokens issued for it",
+			"client_id", code.ClientID, "user_id", code.UserID, "session_id", code.SessionID)
+		o.revokeReplayedCode(ctx, code, info)
+
+		return nil, fmt.Errorf("%w: authorization code already used", errors2.ErrOAuthInvalidGrant)
+	case time.Now().After(code.ExpiresAt):
+		return nil, fmt.Errorf("%w: authorization code expired", errors2.ErrOAuthInvalidGrant)
+	case code.ClientID != client.ID:
+		return nil, fmt.Errorf("%w: code was issued to another client", errors2.ErrOAuthInvalidGrant)
+	case code.RedirectURI != "" && req.RedirectURI != code.RedirectURI,
+		code.RedirectURI == "" && req.RedirectURI != "" && !slices.Contains(client.RedirectURIs, req.RedirectURI):
+		return nil, fmt.Errorf("%w: redirect_uri mismatch", errors2.ErrOAuthInvalidGrant)
+	case !verifyChallenge(req.CodeVerifier, code.CodeChallenge):
+		return nil, fmt.Errorf("%w: PKCE verification failed", errors2.ErrOAuthInvalidGrant)
+	}
+
+	info.ID = code.UserID
+	info.ClientID = client.ID
+	info.Format = client.TokenFormat
+	info.SessionID = sessionID
+	tokenPair, err := o.generator.GenerateTokenPair(ctx, info)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to generate token pair", "error", err)
+
+		return nil, errors2.ErrOAuthServerError
+	}
+
+	return tokenPair, nil
+}
+
+// revokeReplayedCode revokes the session of the tokens issued for a code used
+// a second time, as the code may have been stolen from either party. Codes
+// consumed before sessions were recorded have none.
+func (o *OAuthServiceImpl) revokeReplayedCode(ctx context.Context, code *models.AuthCode, info *models.UserInfo) {
+	if code.SessionID == "" {
+		return
+	}
+
+	err := o.sessions.Revoke(ctx, code.UserID, code.SessionID, info.IP, info.Agent)
+	if err != nil && !errors.Is(err, errors2.ErrSessionNotFound) {
+		slog.ErrorContext(ctx, "Failed to revoke tokens of a replayed authorization code",
+			"session_id", code.SessionID, "error", err)
+	}
+}
+
+// resolveRedirectURI returns the registered redirect URI matching the requested
+// one. The requested URI may be omitted only when the client has a single one.
+func resolveRedirectURI(client *models.OAuthClient, requested string) (string, error) {
+	if requested == "" {
+		if len(client.RedirectURIs) == 1 {
+			return client.RedirectURIs[0], nil
+		}
+
+		return "", fmt.Errorf("%w: missing redirect_uri", errors2.ErrOAuthInvalidRequest)
+	}
+	if !slices.Contains(client.RedirectURIs, requested) {
+		return "", fmt.Errorf("%w: redirect_uri is not registered", errors2.ErrOAuthInvalidRequest)
+	}
+
+	return requested, nil
+}
+
+// tokenType is the token_type of tokens issued to the client described by
+// info: DPoP-bound if it proved possession of a DPoP key, bearer otherwise.
+func tokenType(info *models.UserInfo) string {
+	if info.JKT != "" {
+		return dpop.TokenType
+	}
+
+	return "Bearer"
+}
+
+func verifyChallenge(verifier, challenge string) bool {
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+func redirectWithError(redirectURI, state string, oauthErr error) string {
+	params := url.Values{}
+	params.Set("error", oauthErr.Error())
+	if state != "" {
+		params.Set("state", state)
+	}
+
+	return appendQuery(redirectURI, params)
+}
+
+func appendQuery(rawURL string, params url.Values) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,98 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	errors2 "jwt-service/internal/errors"
+	"jwt-service/internal/models"
+	"jwt-service/internal/repository"
+	"jwt-service/internal/services/audit"
+	"slices"
+)
+
+const (
+	ActionRedeliverEvent = "redeliver_event"
+
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+var statuses = []string{models.OutboxPending, models.OutboxDelivered, models.OutboxDead}
+
+// OutboxAdmin lets admins inspect the outbox and retry failed deliveries.
+type OutboxAdmin interface {
+	List(ctx context.Context, status string, limit int) ([]models.OutboxEvent, error)
+	// Redeliver schedules an event for another round of delivery attempts on
+	// behalf of the admin actor and records it in the admin audit trail.
+	Redeliver(ctx context.Context, id int64, actor, reason string) error
+}
+
+type OutboxAdminImpl struct {
+	repo    repository.OutboxRepository
+	auditor audit.Auditor
+}
+
+func NewAdmin(repo repository.OutboxRepository, auditor audit.Auditor) *OutboxAdminImpl {
+	return &OutboxAdminImpl{
+		repo:    repo,
+		auditor: auditor,
+	}
+}
+
+func (a *OutboxAdminImpl) List(ctx context.Context, status string, limit int) ([]models.OutboxEvent, error) {
+	if status != "" && !slices.Contains(statuses, status) {
+		return nil, fmt.Errorf("%w: status must be one of %v", errors2.ErrInvalidFilter, statuses)
+	}
+
+	limit = min(limit, maxListLimit)
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+
+	events, err := a.repo.ListOutboxEvents(ctx, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	if events == nil {
+		events = []models.OutboxEvent{}
+	}
+
+	return events, nil
+}
+
+func (a *OutboxAdminImpl) Redeliver(ctx context.Context, id int64, actor, reason string) error {
+	tx, err := a.repo.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	found, err := a.repo.RedeliverOutboxEventTx(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors2.ErrEventNotFound
+	}
+
+	details, err := json.Marshal(map[string]int64{"event_id": id})
+	if err != nil {
+		return err
+	}
+
+	action := models.AdminAction{
+		Action:  ActionRedeliverEvent,
+		Actor:   actor,
+		Reason:  reason,
+		Details: details,
+	}
+	if err = a.repo.SaveAdminActionTx(ctx, tx, action); err != nil {
+		return err
+	}
+	if err = a.auditor.RecordTx(ctx, tx, audit.AdminEvent(action)); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,264 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"jwt-service/internal/config"
+	"jwt-service/internal/metrics"
+	"jwt-service/internal/models"
+	"jwt-service/internal/repository"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Deliveries are signed with HMAC-SHA256 of the timestamp and the body,
+// joined with a dot, so a receiver can reject both forged and replayed
+// requests. The signature is omitted if the target has no secret.
+const (
+	HeaderTimestamp = "Webhook-Timestamp"
+	HeaderSignature = "Webhook-Signature"
+
+	signatureVersion = "v1"
+)
+
+const (
+	pollInterval    = time.Second
+	batchSize       = 50
+	deliveryTimeout = 10 * time.Second
+	// lease must outlast the delivery of a whole batch, or another
+	// dispatcher may deliver the same events again. Every delivery may take
+	// up to deliveryTimeout, the margin covers the queries around them.
+	lease = batchSize*deliveryTimeout + time.Minute
+
+	// Attempt n is retried after baseBackoff * 2^(n-1), up to maxBackoff.
+	// After maxAttempts the event is moved to the dead state.
+	baseBackoff = 5 * time.Second
+	maxBackoff  = time.Hour
+	maxAttempts = 10
+)
+
+var tracer = otel.Tracer("jwt-service/internal/services/outbox")
+
+type Dispatcher struct {
+	repo          repository.OutboxRepository
+	client        *http.Client
+	webhookSecret atomic.Pointer[string]
+
+	// polledAt is the time, in Unix nanoseconds, of the last poll.
+	polledAt atomic.Int64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewDispatcher(repo repository.OutboxRepository, cfg *config.Config) *Dispatcher {
+	d := &Dispatcher{
+		repo:   repo,
+		client: &http.Client{Timeout: deliveryTimeout},
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	d.webhookSecret.Store(&cfg.WebhookSecret)
+	d.polledAt.Store(time.Now().UnixNano())
+
+	return d
+}
+
+// Run delivers due events until ctx is done or Shutdown is called.
+func (d *Dispatcher) Run(ctx context.Context) {
+	defer close(d.done)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.stop:
+			return
+		case <-ticker.C:
+			d.dispatch(ctx)
+			d.polledAt.Store(time.Now().UnixNano())
+		}
+	}
+}
+
+// Shutdown stops Run once the batch in progress is delivered, then delivers
+// the events that are due, the ones published by the last requests among
+// them, until ctx is done.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	close(d.stop)
+	select {
+	case <-d.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	for ctx.Err() == nil {
+		if d.dispatch(ctx) < batchSize {
+			break
+		}
+	}
+
+	return ctx.Err()
+}
+
+// Check reports the dispatcher as wedged if it has not polled for events
+// for longer than a lease, which a batch is delivered within even if every
+// receiver times out.
+func (d *Dispatcher) Check(context.Context) error {
+	if since := time.Since(time.Unix(0, d.polledAt.Load())); since > lease {
+		return fmt.Errorf("no poll for %s", since.Round(time.Second))
+	}
+
+	return nil
+}
+
+// PrepareReload switches deliveries to WEBHOOK_URL to the WEBHOOK_SECRET of
+// cfg.
+func (d *Dispatcher) PrepareReload(_ context.Context, cfg *config.Config) (func(), error) {
+	return func() { d.webhookSecret.Store(&cfg.WebhookSecret) }, nil
+}
+
+// dispatch delivers a batch of due events and returns its size.
+func (d *Dispatcher) dispatch(ctx context.Context) int {
+	events, err := d.repo.ClaimOutboxEvents(ctx, batchSize, lease)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to claim outbox events", "error", err)
+		return 0
+	}
+
+	for _, event := range events {
+		if err = d.deliver(ctx, event); err != nil {
+			// Shutting down: the lease expires and the event is retried.
+			if ctx.Err() != nil {
+				return len(events)
+			}
+			d.fail(ctx, event, err)
+			continue
+		}
+		metrics.WebhookDeliveries.WithLabelValues("delivered").Inc()
+
+		if err = d.repo.MarkOutboxDelivered(ctx, event.ID); err != nil {
+			slog.ErrorContext(ctx, "Failed to mark outbox event delivered", "event_id", event.ID, "error", err)
+		}
+	}
+
+	return len(events)
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, event models.OutboxEvent) (err error) {
+	// The delivery joins the trace of the request that caused the event.
+	ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(event.TraceContext))
+	ctx, span := tracer.Start(ctx, "webhook "+event.EventType, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.Int64("outbox.event_id", event.ID),
+			attribute.Int("outbox.attempt", event.Attempts+1),
+			// Not the full URL, which may hold credentials.
+			semconv.ServerAddress(hostname(event.Target)),
+		))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	secret := *d.webhookSecret.Load()
+	if event.SubscriptionID != "" {
+		if secret, err = d.repo.GetWebhookSecret(ctx, event.SubscriptionID); err != nil {
+			return fmt.Errorf("failed to get subscription secret: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, event.Target, bytes.NewReader(event.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/cloudevents+json")
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	if secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(HeaderTimestamp, timestamp)
+		req.Header.Set(HeaderSignature, Sign(secret, timestamp, event.Payload))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return nil
+}
+
+func (d *Dispatcher) fail(ctx context.Context, event models.OutboxEvent, deliveryErr error) {
+	attempts := event.Attempts + 1
+	dead := attempts >= maxAttempts
+	if dead {
+		metrics.WebhookDeliveries.WithLabelValues("dead").Inc()
+		slog.ErrorContext(ctx, "Outbox event is dead", "event_id", event.ID, "attempts", attempts, "error", deliveryErr)
+	} else {
+		metrics.WebhookDeliveries.WithLabelValues("failed").Inc()
+		slog.WarnContext(ctx, "Failed to deliver outbox event", "event_id", event.ID, "attempt", attempts, "error", deliveryErr)
+	}
+
+	if err := d.repo.MarkOutboxFailed(ctx, event.ID, deliveryErr.Error(), backoff(attempts), dead); err != nil {
+		slog.ErrorContext(ctx, "Failed to record outbox delivery failure", "error", err)
+	}
+}
+
+func hostname(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	return u.Hostname()
+}
+
+// backoff returns the delay before retrying after the given number of
+// attempts, with up to 20% of jitter so failed events do not retry in step.
+func backoff(attempts int) time.Duration {
+	delay := maxBackoff
+	if shift := attempts - 1; shift < 20 {
+		delay = min(baseBackoff<<shift, maxBackoff)
+	}
+
+	return delay + rand.N(delay/5+1)
+}
+
+// Sign returns the value of the signature header for a delivery of body at
+// timestamp, in Unix seconds.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return signatureVersion + "=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,65 @@
+package outbox
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"time"
+)
+
+// Event types, as used in subscription filters. The CloudEvents type of an
+// event is eventTypePrefix + type + "." + eventVersion.
+const (
+	EventTokenIssued       = "token.issued"
+	EventTokenRefreshed    = "token.refreshed"
+	EventUserAgentMismatch = "token.user_agent_mismatch"
+	EventIPChanged         = "token.ip_changed"
+	EventLogout            = "user.logout"
+	EventReuseDetected     = "token.reuse_detected"
+	EventKeyRotated        = "key.rotated"
+)
+
+// EventTypes lists every event type a subscription may filter on.
+var EventTypes = []string{
+	EventTokenIssued,
+	EventTokenRefreshed,
+	EventUserAgentMismatch,
+	EventIPChanged,
+	EventLogout,
+	EventReuseDetected,
+	EventKeyRotated,
+}
+
+const (
+	eventSource     = "/jwt-service"
+	eventTypePrefix = "jwt-service."
+	// eventVersion is bumped on incompatible changes of the data of events.
+	eventVersion = "v1"
+)
+
+// cloudEvent is the CloudEvents 1.0 envelope of webhook payloads in
+// structured content mode.
+type cloudEvent struct {
+	SpecVersion     string    `json:"specversion"`
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	Type            string    `json:"type"`
+	Subject         string    `json:"subject,omitempty"`
+	Time            time.Time `json:"time"`
+	DataContentType string    `json:"datacontenttype"`
+	Data            any       `json:"data"`
+}
+
+// newEnvelope wraps data in an envelope. The event ID stays the same across
+// deliveries, so receivers can use it to drop duplicates.
+func newEnvelope(eventType, subject string, data any) ([]byte, error) {
+	return json.Marshal(cloudEvent{
+		SpecVersion:     "1.0",
+		ID:              uuid.NewString(),
+		Source:          eventSource,
+		Type:            eventTypePrefix + eventType + "." + eventVersion,
+		Subject:         subject,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		Data:            data,
+	})
+}
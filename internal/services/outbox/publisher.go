@@ -0,0 +1,64 @@
+package outbox
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"jwt-service/internal/config"
+	"jwt-service/internal/models"
+	"jwt-service/internal/repository"
+	"sync/atomic"
+)
+
+type Publisher interface {
+	// PublishTx writes an event about subject to the outbox within tx, once
+	// for WEBHOOK_URL and once for every subscription of eventType, so it is
+	// delivered if and only if tx commits.
+	PublishTx(ctx context.Context, tx pgx.Tx, eventType, subject string, data any) error
+}
+
+type PublisherImpl struct {
+	repo       repository.OutboxRepository
+	webhookURL atomic.Pointer[string]
+}
+
+func NewPublisher(repo repository.OutboxRepository, cfg *config.Config) *PublisherImpl {
+	p := &PublisherImpl{
+		repo: repo,
+	}
+	p.webhookURL.Store(&cfg.WebhookURL)
+
+	return p
+}
+
+// PrepareReload switches the events published from then on to the
+// WEBHOOK_URL of cfg. Events already in the outbox keep their target.
+func (p *PublisherImpl) PrepareReload(_ context.Context, cfg *config.Config) (func(), error) {
+	return func() { p.webhookURL.Store(&cfg.WebhookURL) }, nil
+}
+
+func (p *PublisherImpl) PublishTx(ctx context.Context, tx pgx.Tx, eventType, subject string, data any) error {
+	payload, err := newEnvelope(eventType, subject, data)
+	if err != nil {
+		return err
+	}
+
+	traceContext := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, traceContext)
+
+	event := models.OutboxEvent{
+		EventType:    eventType,
+		Payload:      payload,
+		TraceContext: traceContext,
+	}
+
+	if webhookURL := *p.webhookURL.Load(); webhookURL != "" {
+		event.Target = webhookURL
+		if err = p.repo.SaveOutboxEventTx(ctx, tx, event); err != nil {
+			return err
+		}
+	}
+
+	return p.repo.SaveSubscribedEventsTx(ctx, tx, event)
+}
@@ -0,0 +1,168 @@
+package outbox
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	errors2 "jwt-service/internal/errors"
+	"jwt-service/internal/models"
+	"jwt-service/internal/repository"
+	"jwt-service/internal/services/audit"
+	"net/url"
+	"slices"
+	"time"
+)
+
+const (
+	ActionCreateWebhook = "create_webhook"
+	ActionDeleteWebhook = "delete_webhook"
+
+	secretSize = 32
+)
+
+// Subscriptions manages the registry of webhook endpoints.
+type Subscriptions interface {
+	List(ctx context.Context) ([]models.WebhookSubscription, error)
+	// Create registers an endpoint on behalf of the admin actor. The
+	// returned subscription holds its signing secret, which is not shown
+	// again.
+	Create(ctx context.Context, req models.CreateWebhookRequest, actor string) (*models.WebhookSubscription, error)
+	// Delete removes an endpoint together with its undelivered events.
+	Delete(ctx context.Context, id, actor, reason string) error
+}
+
+type SubscriptionsImpl struct {
+	repo    repository.OutboxRepository
+	auditor audit.Auditor
+}
+
+func NewSubscriptions(repo repository.OutboxRepository, auditor audit.Auditor) *SubscriptionsImpl {
+	return &SubscriptionsImpl{
+		repo:    repo,
+		auditor: auditor,
+	}
+}
+
+func (s *SubscriptionsImpl) List(ctx context.Context) ([]models.WebhookSubscription, error) {
+	subs, err := s.repo.ListWebhookSubscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if subs == nil {
+		subs = []models.WebhookSubscription{}
+	}
+
+	return subs, nil
+}
+
+func (s *SubscriptionsImpl) Create(ctx context.Context, req models.CreateWebhookRequest,
+	actor string) (*models.WebhookSubscription, error) {
+	target, err := url.Parse(req.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("%w: url must be an absolute http(s) URL", errors2.ErrInvalidSubscription)
+	}
+	for _, eventType := range req.EventTypes {
+		if !slices.Contains(EventTypes, eventType) {
+			return nil, fmt.Errorf("%w: unknown event type %q, must be one of %v",
+				errors2.ErrInvalidSubscription, eventType, EventTypes)
+		}
+	}
+
+	secret := make([]byte, secretSize)
+	if _, err = rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	eventTypes := req.EventTypes
+	if eventTypes == nil {
+		eventTypes = []string{}
+	}
+	sub := models.WebhookSubscription{
+		ID:         uuid.NewString(),
+		URL:        req.URL,
+		Secret:     base64.RawURLEncoding.EncodeToString(secret),
+		EventTypes: eventTypes,
+		CreatedAt:  time.Now(),
+	}
+
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err = s.repo.SaveWebhookSubscriptionTx(ctx, tx, sub); err != nil {
+		return nil, err
+	}
+
+	details, err := json.Marshal(map[string]any{
+		"subscription_id": sub.ID,
+		"url":             sub.URL,
+		"event_types":     sub.EventTypes,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	action := models.AdminAction{
+		Action:  ActionCreateWebhook,
+		Actor:   actor,
+		Reason:  req.Reason,
+		Details: details,
+	}
+	if err = s.repo.SaveAdminActionTx(ctx, tx, action); err != nil {
+		return nil, err
+	}
+	if err = s.auditor.RecordTx(ctx, tx, audit.AdminEvent(action)); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &sub, nil
+}
+
+func (s *SubscriptionsImpl) Delete(ctx context.Context, id, actor, reason string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return errors2.ErrSubscriptionNotFound
+	}
+
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	found, err := s.repo.DeleteWebhookSubscriptionTx(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors2.ErrSubscriptionNotFound
+	}
+
+	details, err := json.Marshal(map[string]string{"subscription_id": id})
+	if err != nil {
+		return err
+	}
+
+	action := models.AdminAction{
+		Action:  ActionDeleteWebhook,
+		Actor:   actor,
+		Reason:  reason,
+		Details: details,
+	}
+	if err = s.repo.SaveAdminActionTx(ctx, tx, action); err != nil {
+		return err
+	}
+	if err = s.auditor.RecordTx(ctx, tx, audit.AdminEvent(action)); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,52 @@
+package rate_limit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps the rate limits in memory, for a single instance of the
+// service.
+type MemoryStore struct {
+	mu   sync.Mutex
+	tats map[string]time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		tats: make(map[string]time.Time),
+	}
+}
+
+func (m *MemoryStore) ReserveRateLimit(_ context.Context, key string, now time.Time,
+	interval, window time.Duration) (time.Time, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tat := m.tats[key]
+	if tat.Before(now) {
+		tat = now
+	}
+	if tat.Add(interval).After(now.Add(window)) {
+		return tat, false, nil
+	}
+	m.tats[key] = tat.Add(interval)
+
+	return tat.Add(interval), true, nil
+}
+
+func (m *MemoryStore) DeleteExpiredRateLimits(_ context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var n int64
+	for key, tat := range m.tats {
+		if tat.Before(before) {
+			delete(m.tats, key)
+			n++
+		}
+	}
+
+	return n, nil
+}
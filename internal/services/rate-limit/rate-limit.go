@@ -0,0 +1,142 @@
+package rate_limit
+
+import (
+	"context"
+	"jwt-service/internal/config"
+	"jwt-service/internal/repository"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// Scopes of the limits.
+const (
+	ScopeIP     = "ip"
+	ScopeClient = "client"
+	ScopeUser   = "user"
+)
+
+const (
+	// sweepInterval is how often keys at their initial state are deleted.
+	sweepInterval = time.Minute
+	sweepTimeout  = 10 * time.Second
+)
+
+// Result describes a limit after a request was counted against it.
+type Result struct {
+	Scope string
+	// Limit is the number of requests allowed per Window, 0 if the scope
+	// is not limited.
+	Limit     int
+	Window    time.Duration
+	Remaining int
+	// Reset is the time until the limit is fully available again.
+	Reset time.Duration
+	// RetryAfter is the time until a rejected request would be allowed,
+	// 0 if it is allowed.
+	RetryAfter time.Duration
+}
+
+func (r Result) Allowed() bool {
+	return r.RetryAfter == 0
+}
+
+// Limiter limits requests with the generic cell rate algorithm (GCRA), a
+// token bucket that refills one request every window divided by the limit
+// and holds up to the limit, kept as a single timestamp per key.
+type Limiter interface {
+	// Allow counts a request of id against the limit of scope.
+	Allow(ctx context.Context, scope, id string) (Result, error)
+}
+
+type LimiterImpl struct {
+	repo   repository.RateLimitRepository
+	limits atomic.Pointer[limits]
+
+	// sweptAt is the time, in Unix nanoseconds, of the last sweep.
+	sweptAt atomic.Int64
+}
+
+type limits struct {
+	window   time.Duration
+	requests map[string]int
+}
+
+func New(repo repository.RateLimitRepository, cfg *config.Config) *LimiterImpl {
+	l := &LimiterImpl{
+		repo: repo,
+	}
+	l.limits.Store(newLimits(cfg))
+	l.sweptAt.Store(time.Now().UnixNano())
+
+	return l
+}
+
+// PrepareReload switches to the limits of cfg. The requests already counted
+// carry over.
+func (l *LimiterImpl) PrepareReload(_ context.Context, cfg *config.Config) (func(), error) {
+	return func() { l.limits.Store(newLimits(cfg)) }, nil
+}
+
+func newLimits(cfg *config.Config) *limits {
+	return &limits{
+		window: cfg.RateLimitWindow,
+		requests: map[string]int{
+			ScopeIP:     cfg.RateLimitPerIP,
+			ScopeClient: cfg.RateLimitPerClient,
+			ScopeUser:   cfg.RateLimitPerUser,
+		},
+	}
+}
+
+func (l *LimiterImpl) Allow(ctx context.Context, scope, id string) (Result, error) {
+	lim := l.limits.Load()
+	n := lim.requests[scope]
+	if n <= 0 {
+		return Result{Scope: scope}, nil
+	}
+
+	now := time.Now()
+	l.maybeSweep(now)
+
+	interval := max(lim.window/time.Duration(n), 1)
+	tat, ok, err := l.repo.ReserveRateLimit(ctx, scope+":"+id, now, interval, lim.window)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{
+		Scope:  scope,
+		Limit:  n,
+		Window: lim.window,
+		Reset:  max(tat.Sub(now), 0),
+	}
+	if ok {
+		result.Remaining = int((lim.window - tat.Sub(now)) / interval)
+	} else {
+		// The request fits once the TAT moved by it is within the window.
+		result.RetryAfter = tat.Add(interval).Sub(now) - lim.window
+	}
+
+	return result, nil
+}
+
+// maybeSweep deletes the keys at their initial state in the background, at
+// most once per sweepInterval.
+func (l *LimiterImpl) maybeSweep(now time.Time) {
+	last := l.sweptAt.Load()
+	if now.UnixNano()-last < int64(sweepInterval) || !l.sweptAt.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+
+	// Sweeps maintain state shared by all requests, so they are not part
+	// of the one that happens to trigger them.
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), sweepTimeout)
+		defer cancel()
+
+		if _, err := l.repo.DeleteExpiredRateLimits(ctx, now); err != nil {
+			slog.WarnContext(ctx, "Failed to delete expired rate limits", "error", err)
+		}
+	}()
+}
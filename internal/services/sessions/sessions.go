@@ -0,0 +1,321 @@
+package sessions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/mileusna/useragent"
+	"jwt-service/internal/config"
+	errors2 "jwt-service/internal/errors"
+	"jwt-service/internal/models"
+	"jwt-service/internal/repository"
+	"jwt-service/internal/services/audit"
+	"time"
+)
+
+const (
+	ActionRevokeSessions = "revoke_sessions"
+
+	defaultSearchLimit = 100
+	maxSearchLimit     = 1000
+)
+
+type SessionService interface {
+	// List returns the active sessions of userID. The session with
+	// currentSessionID is flagged as the current one.
+	List(ctx context.Context, userID, currentSessionID string) ([]models.SessionResponse, error)
+	// Revoke signs userID out of one of their sessions. ip and userAgent
+	// are those of the request, for the audit log.
+	Revoke(ctx context.Context, userID, sessionID, ip, userAgent string) error
+	// RevokeOthers signs userID out of every session except the current one
+	// and returns how many sessions were revoked.
+	RevokeOthers(ctx context.Context, userID, currentSessionID, ip, userAgent string) (int, error)
+
+	// Search returns the active sessions of any user matching req.
+	Search(ctx context.Context, req *models.SessionSearchRequest) ([]models.SessionResponse, error)
+	// RevokeMatching revokes every active session matching req on behalf of
+	// the admin actor and records it in the admin audit trail.
+	RevokeMatching(ctx context.Context, req *models.RevokeSessionsRequest, actor string) (int64, error)
+}
+
+type SessionServiceImpl struct {
+	repo      repository.SessionRepository
+	auditor   audit.Auditor
+	accessTTL time.Duration
+}
+
+func New(repo repository.SessionRepository, auditor audit.Auditor, cfg *config.Config) *SessionServiceImpl {
+	return &SessionServiceImpl{
+		repo:      repo,
+		auditor:   auditor,
+		accessTTL: cfg.AccessTokenTTL,
+	}
+}
+
+func (s *SessionServiceImpl) List(ctx context.Context, userID, currentSessionID string) ([]models.SessionResponse, error) {
+	sessions, err := s.repo.ListSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make([]models.SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		resp = append(resp, toResponse(session, session.ID == currentSessionID))
+	}
+
+	return resp, nil
+}
+
+func (s *SessionServiceImpl) Revoke(ctx context.Context, userID, sessionID, ip, userAgent string) error {
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	revoked, err := s.repo.RevokeSessionTx(ctx, tx, userID, sessionID, s.accessIssuedAfter())
+	if err != nil {
+		return err
+	}
+	// Sessions of other users are indistinguishable from missing ones.
+	if !revoked {
+		return errors2.ErrSessionNotFound
+	}
+
+	if err = s.auditor.RecordTx(ctx, tx, revokedEvent(userID, sessionID, ip, userAgent)); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *SessionServiceImpl) RevokeOthers(ctx context.Context, userID, currentSessionID, ip, userAgent string) (int, error) {
+	if currentSessionID == "" {
+		return 0, errors2.ErrNoSession
+	}
+
+	sessions, err := s.repo.ListSessions(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var revokedIDs []string
+	issuedAfter := s.accessIssuedAfter()
+	for _, session := range sessions {
+		if session.ID == currentSessionID {
+			continue
+		}
+
+		revoked, err := s.repo.RevokeSessionTx(ctx, tx, userID, session.ID, issuedAfter)
+		if err != nil {
+			return 0, err
+		}
+		if revoked {
+			revokedIDs = append(revokedIDs, session.ID)
+		}
+	}
+
+	for _, sessionID := range revokedIDs {
+		if err = s.auditor.RecordTx(ctx, tx, revokedEvent(userID, sessionID, ip, userAgent)); err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return len(revokedIDs), nil
+}
+
+func (s *SessionServiceImpl) Search(ctx context.Context,
+	req *models.SessionSearchRequest) ([]models.SessionResponse, error) {
+	filter, err := parseFilter(req)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := min(req.Limit, maxSearchLimit)
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+
+	sessions, err := s.repo.SearchSessions(ctx, filter, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make([]models.SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		r := toResponse(session, false)
+		r.UserID = session.UserID
+		resp = append(resp, r)
+	}
+
+	return resp, nil
+}
+
+func (s *SessionServiceImpl) RevokeMatching(ctx context.Context, req *models.RevokeSessionsRequest,
+	actor string) (int64, error) {
+	filter, err := parseFilter(&req.SessionSearchRequest)
+	if err != nil {
+		return 0, err
+	}
+	// Revoking everything is the kill switch's job.
+	if filter.IsEmpty() {
+		return 0, fmt.Errorf("%w: at least one criterion is required", errors2.ErrInvalidFilter)
+	}
+	if req.Reason == "" {
+		return 0, errors2.ErrReasonRequired
+	}
+
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	count, err := s.repo.RevokeSessionsTx(ctx, tx, filter, s.accessIssuedAfter())
+	if err != nil {
+		return 0, err
+	}
+
+	details, err := json.Marshal(map[string]any{
+		"filter":  req.SessionSearchRequest,
+		"revoked": count,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	action := models.AdminAction{
+		Action:  ActionRevokeSessions,
+		Actor:   actor,
+		Reason:  req.Reason,
+		Details: details,
+	}
+	if err = s.repo.SaveAdminActionTx(ctx, tx, action); err != nil {
+		return 0, err
+	}
+	if err = s.auditor.RecordTx(ctx, tx, audit.AdminEvent(action)); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func revokedEvent(userID, sessionID, ip, userAgent string) models.AuthEvent {
+	return models.AuthEvent{
+		EventType: audit.EventSessionRevoked,
+		Outcome:   models.OutcomeSuccess,
+		Actor:     audit.UserActor(userID, ""),
+		Subject:   userID,
+		SessionID: sessionID,
+		IP:        ip,
+		UserAgent: userAgent,
+	}
+}
+
+func parseFilter(req *models.SessionSearchRequest) (models.SessionFilter, error) {
+	filter := models.SessionFilter{
+		UserID:    req.UserID,
+		UserAgent: req.UserAgent,
+	}
+
+	if req.UserID != "" {
+		if _, err := uuid.Parse(req.UserID); err != nil {
+			return filter, fmt.Errorf("%w: user_id must be a UUID", errors2.ErrInvalidFilter)
+		}
+	}
+
+	if req.IP != "" {
+		prefix, err := models.ParseIPPrefix(req.IP)
+		if err != nil {
+			return filter, fmt.Errorf("%w: ip must be an address or a CIDR", errors2.ErrInvalidFilter)
+		}
+		filter.IP = &prefix
+	}
+
+	var err error
+	if filter.IssuedAfter, err = parseTime(req.IssuedAfter, "issued_after"); err != nil {
+		return filter, err
+	}
+	if filter.IssuedBefore, err = parseTime(req.IssuedBefore, "issued_before"); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+// parseTime parses an RFC 3339 time. issued_at is stored in the server's
+// local time without a zone, so the result is converted to it.
+func parseTime(s, name string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s must be an RFC 3339 time", errors2.ErrInvalidFilter, name)
+	}
+	t = t.Local()
+
+	return &t, nil
+}
+
+func toResponse(session models.Session, current bool) models.SessionResponse {
+	ua := useragent.Parse(session.UserAgent)
+
+	return models.SessionResponse{
+		ID:         session.ID,
+		DeviceType: deviceType(ua),
+		Device:     ua.Device,
+		OS:         joinVersion(ua.OS, ua.OSVersion),
+		Browser:    joinVersion(ua.Name, ua.Version),
+		UserAgent:  session.UserAgent,
+		IP:         session.IP,
+		FirstSeen:  session.FirstSeen,
+		LastUsed:   session.LastUsed,
+		Current:    current,
+	}
+}
+
+// accessIssuedAfter returns the issue time before which access tokens have
+// expired and need not be blacklisted.
+func (s *SessionServiceImpl) accessIssuedAfter() time.Time {
+	return time.Now().Add(-s.accessTTL)
+}
+
+func deviceType(ua useragent.UserAgent) string {
+	switch {
+	case ua.Bot:
+		return "bot"
+	case ua.Tablet:
+		return "tablet"
+	case ua.Mobile:
+		return "mobile"
+	case ua.Desktop:
+		return "desktop"
+	default:
+		return "unknown"
+	}
+}
+
+func joinVersion(name, version string) string {
+	if name == "" || version == "" {
+		return name
+	}
+
+	return name + " " + version
+}
@@ -0,0 +1,176 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"jwt-service/internal/models"
+	"os"
+	"path/filepath"
+)
+
+// FileSink appends events to a file as JSON lines. Once the file would grow
+// past maxSize it is renamed to path.1, the previous path.1 to path.2 and so
+// on, keeping at most maxBackups old files.
+//
+// The file is local to the instance, so every instance of the service writes
+// the whole log to its own file and keeps its own position in it.
+type FileSink struct {
+	name       string
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	file *os.File
+	size int64
+	// written is the seq of the last event in the file, the events a batch
+	// written again after a failure starts with are skipped.
+	written int64
+}
+
+func NewFileSink(path string, maxSize int64, maxBackups int) (*FileSink, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("audit file: maximum size must be positive")
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("audit file: %w", err)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("audit file: %w", err)
+	}
+
+	s := &FileSink{
+		name:       "file:" + hostname + ":" + abs,
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: max(maxBackups, 0),
+	}
+
+	return s, s.open()
+}
+
+func (s *FileSink) Name() string {
+	return s.name
+}
+
+// Write ignores ctx, writes to a local file are not cancelled.
+func (s *FileSink) Write(ctx context.Context, events []models.AuthEvent) error {
+	for len(events) > 0 && events[0].Seq <= s.written {
+		events = events[1:]
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	// A failed rotation leaves no file open.
+	if s.file == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for i, event := range events {
+		line := buf.Len()
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+
+		// A line longer than maxSize gets a file of its own.
+		if s.size+int64(buf.Len()) > s.maxSize && s.size+int64(line) > 0 {
+			// Flush the lines before this one, they still fit.
+			if err := s.write(buf.Bytes()[:line]); err != nil {
+				return err
+			}
+			if i > 0 {
+				s.written = events[i-1].Seq
+			}
+			if err := s.rotate(); err != nil {
+				return err
+			}
+			buf.Next(line)
+		}
+	}
+
+	if err := s.write(buf.Bytes()); err != nil {
+		return err
+	}
+	s.written = events[len(events)-1].Seq
+
+	return nil
+}
+
+func (s *FileSink) Close() error {
+	if s.file == nil {
+		return nil
+	}
+
+	return s.file.Close()
+}
+
+func (s *FileSink) write(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	n, err := s.file.Write(data)
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+
+	return s.file.Sync()
+}
+
+func (s *FileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	s.file = file
+	s.size = info.Size()
+
+	return nil
+}
+
+func (s *FileSink) rotate() error {
+	err := s.file.Close()
+	s.file = nil
+	if err != nil {
+		return err
+	}
+
+	if s.maxBackups == 0 {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return s.open()
+	}
+
+	for i := s.maxBackups - 1; i >= 1; i-- {
+		err := os.Rename(s.backup(i), s.backup(i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(s.path, s.backup(1)); err != nil {
+		return err
+	}
+
+	return s.open()
+}
+
+func (s *FileSink) backup(i int) string {
+	return fmt.Sprintf("%s.%d", s.path, i)
+}
@@ -0,0 +1,148 @@
+package sink
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"jwt-service/internal/repository"
+	"log/slog"
+	"time"
+)
+
+const (
+	pollInterval = time.Second
+	batchSize    = 500
+
+	// A failing sink is retried after a delay doubling up to maxRetryDelay.
+	baseRetryDelay = time.Second
+	maxRetryDelay  = time.Minute
+
+	// leaseTTL outlasts a batch, whose write is bounded by writeTimeout.
+	leaseTTL = 3 * writeTimeout
+)
+
+// Forwarder feeds a sink from the audit log. The position of every sink is
+// kept in the database, so the audit log itself buffers the events of a slow
+// or unavailable sink, and requests that record events never wait for one.
+// With several instances of the service the one holding the lease of the
+// position forwards, another one takes over once it expires.
+type Forwarder struct {
+	repo repository.SinkRepository
+	sink Sink
+	// id identifies the forwarder as the holder of the lease.
+	id string
+
+	retryDelay time.Duration
+	retryAt    time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewForwarder(repo repository.SinkRepository, sink Sink) *Forwarder {
+	return &Forwarder{
+		repo: repo,
+		sink: sink,
+		id:   uuid.NewString(),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+// Run forwards new events until ctx is done or Shutdown is called.
+func (f *Forwarder) Run(ctx context.Context) {
+	defer close(f.done)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-f.stop:
+			return
+		case <-ticker.C:
+			if time.Now().Before(f.retryAt) {
+				continue
+			}
+			f.forwardAll(ctx)
+		}
+	}
+}
+
+// Shutdown stops Run, forwards the events recorded since its last batch
+// until ctx is done, releases the lease and closes the sink.
+func (f *Forwarder) Shutdown(ctx context.Context) error {
+	defer func() {
+		if err := f.repo.ReleaseSinkCursor(context.WithoutCancel(ctx), f.sink.Name(), f.id); err != nil {
+			slog.ErrorContext(ctx, "Failed to release audit sink", "sink", f.sink.Name(), "error", err)
+		}
+		if err := f.sink.Close(); err != nil {
+			slog.ErrorContext(ctx, "Failed to close audit sink", "sink", f.sink.Name(), "error", err)
+		}
+	}()
+
+	close(f.stop)
+	select {
+	case <-f.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	f.forwardAll(ctx)
+
+	return ctx.Err()
+}
+
+// forwardAll forwards batches until the sink has caught up or fails.
+func (f *Forwarder) forwardAll(ctx context.Context) {
+	for ctx.Err() == nil {
+		n, err := f.forward(ctx)
+		if err != nil {
+			f.retryDelay = min(max(2*f.retryDelay, baseRetryDelay), maxRetryDelay)
+			f.retryAt = time.Now().Add(f.retryDelay)
+			slog.WarnContext(ctx, "Failed to forward audit events", "sink", f.sink.Name(),
+				"retry_in", f.retryDelay, "error", err)
+			return
+		}
+		f.retryDelay = 0
+
+		if n < batchSize {
+			return
+		}
+	}
+}
+
+// forward writes the next batch of events. No transaction is open while the
+// sink is written to: the position is advanced after the write, only if the
+// lease was kept. A batch is written again if that fails, so delivery is at
+// least once.
+func (f *Forwarder) forward(ctx context.Context) (int, error) {
+	seq, ok, err := f.repo.ClaimSinkCursor(ctx, f.sink.Name(), f.id, leaseTTL)
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	events, err := f.repo.ListChainedAuthEvents(ctx, seq, batchSize)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+
+	writeCtx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+	if err = f.sink.Write(writeCtx, events); err != nil {
+		return 0, err
+	}
+
+	ok, err = f.repo.AdvanceSinkCursor(ctx, f.sink.Name(), f.id, seq, events[len(events)-1].Seq)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		slog.WarnContext(ctx, "Lost the audit sink lease during a write, the batch may be written twice",
+			"sink", f.sink.Name(), "after_seq", seq)
+		return 0, nil
+	}
+
+	return len(events), nil
+}
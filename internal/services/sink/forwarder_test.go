@@ -0,0 +1,103 @@
+package sink
+
+import (
+	"context"
+	"jwt-service/internal/models"
+	"jwt-service/internal/repository"
+	"testing"
+	"time"
+)
+
+// cursorRepo holds the position and the lease of a single sink.
+type cursorRepo struct {
+	repository.SinkRepository
+	events []models.AuthEvent
+	seq    int64
+	owner  string
+}
+
+func (r *cursorRepo) ClaimSinkCursor(ctx context.Context, name, owner string, lease time.Duration) (int64, bool,
+	error) {
+	if r.owner != "" && r.owner != owner {
+		return 0, false, nil
+	}
+	r.owner = owner
+
+	return r.seq, true, nil
+}
+
+func (r *cursorRepo) AdvanceSinkCursor(ctx context.Context, name, owner string, from, to int64) (bool, error) {
+	if r.owner != owner || r.seq != from {
+		return false, nil
+	}
+	r.seq = to
+
+	return true, nil
+}
+
+func (r *cursorRepo) ListChainedAuthEvents(ctx context.Context, afterSeq int64, limit int) ([]models.AuthEvent,
+	error) {
+	var events []models.AuthEvent
+	for _, event := range r.events {
+		if event.Seq > afterSeq && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+
+	return events, nil
+}
+
+// recordingSink records the batches written to it, and hands the lease of
+// repo to another instance during a write if steal is set.
+type recordingSink struct {
+	repo    *cursorRepo
+	steal   bool
+	batches [][]models.AuthEvent
+}
+
+func (s *recordingSink) Name() string { return "test" }
+func (s *recordingSink) Close() error { return nil }
+
+func (s *recordingSink) Write(ctx context.Context, events []models.AuthEvent) error {
+	if _, ok := ctx.Deadline(); !ok {
+		return context.DeadlineExceeded
+	}
+	if s.steal {
+		s.repo.owner = "other"
+	}
+	s.batches = append(s.batches, events)
+
+	return nil
+}
+
+func TestForwarder(t *testing.T) {
+	repo := &cursorRepo{events: testEvents(3)}
+	s := &recordingSink{repo: repo}
+	f := NewForwarder(repo, s)
+
+	if n, err := f.forward(context.Background()); err != nil || n != 3 {
+		t.Fatalf("forward() = %d, %v, want 3 events", n, err)
+	}
+	if repo.seq != 3 {
+		t.Errorf("position %d, want 3", repo.seq)
+	}
+
+	repo.events = append(repo.events, testEvents(5)[3:]...)
+	s.steal = true
+	if n, err := f.forward(context.Background()); err != nil || n != 0 {
+		t.Fatalf("forward() with the lease lost = %d, %v, want nothing forwarded", n, err)
+	}
+	if repo.seq != 3 {
+		t.Errorf("position %d after the lease was lost, want 3", repo.seq)
+	}
+	if len(s.batches) != 2 {
+		t.Errorf("%d batches written, want 2", len(s.batches))
+	}
+
+	if n, err := f.forward(context.Background()); err != nil || n != 0 {
+		t.Fatalf("forward() without the lease = %d, %v, want nothing forwarded", n, err)
+	}
+	if len(s.batches) != 2 {
+		t.Errorf("%d batches written without the lease, want 2", len(s.batches))
+	}
+}
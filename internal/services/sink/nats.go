@@ -0,0 +1,61 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/nats-io/nats.go"
+	"jwt-service/internal/models"
+)
+
+// NATSSink publishes each event as JSON to the subject prefix followed by
+// the event type, e.g. jwt-service.audit.token.issued.
+type NATSSink struct {
+	url    string
+	prefix string
+
+	conn *nats.Conn
+}
+
+func NewNATSSink(url, subjectPrefix string) *NATSSink {
+	return &NATSSink{
+		url:    url,
+		prefix: subjectPrefix,
+	}
+}
+
+func (s *NATSSink) Name() string {
+	return "nats"
+}
+
+func (s *NATSSink) Write(ctx context.Context, events []models.AuthEvent) error {
+	if s.conn == nil {
+		conn, err := nats.Connect(s.url, nats.Name(appName), nats.Timeout(writeTimeout),
+			nats.MaxReconnects(-1))
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if err = s.conn.Publish(s.prefix+"."+event.EventType, data); err != nil {
+			return err
+		}
+	}
+
+	// Core NATS has no acknowledgements, a flush at least makes sure the
+	// server got the batch.
+	return s.conn.FlushWithContext(ctx)
+}
+
+func (s *NATSSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+
+	return s.conn.Drain()
+}
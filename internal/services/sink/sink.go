@@ -0,0 +1,49 @@
+package sink
+
+import (
+	"context"
+	"jwt-service/internal/config"
+	"jwt-service/internal/models"
+	"time"
+)
+
+// writeTimeout bounds the write of a batch, including connecting.
+const writeTimeout = 10 * time.Second
+
+// Sink receives the events of the audit log. Write is called with batches in
+// log order from a single goroutine and a ctx with a deadline; a failed batch
+// is written again, so events may arrive more than once but are never
+// skipped.
+type Sink interface {
+	// Name identifies the sink and its position in the log. Instances of
+	// the service writing to the same sink share a name, so only one of
+	// them writes each event.
+	Name() string
+	Write(ctx context.Context, events []models.AuthEvent) error
+	Close() error
+}
+
+// FromConfig returns the sinks enabled in cfg.
+func FromConfig(cfg *config.Config) ([]Sink, error) {
+	var sinks []Sink
+
+	if cfg.AuditFilePath != "" {
+		file, err := NewFileSink(cfg.AuditFilePath, int64(cfg.AuditFileMaxSizeMB)<<20, cfg.AuditFileMaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, file)
+	}
+	if cfg.AuditSyslogAddr != "" {
+		syslog, err := NewSyslogSink(cfg.AuditSyslogAddr)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, syslog)
+	}
+	if cfg.AuditNATSURL != "" {
+		sinks = append(sinks, NewNATSSink(cfg.AuditNATSURL, cfg.AuditNATSSubject))
+	}
+
+	return sinks, nil
+}
@@ -0,0 +1,419 @@
+package sink
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"io"
+	"jwt-service/internal/models"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testEvents(n int) []models.AuthEvent {
+	events := make([]models.AuthEvent, n)
+	for i := range events {
+		events[i] = models.AuthEvent{
+			ID:        int64(100 + i),
+			Seq:       int64(i + 1),
+			EventType: "token.issued",
+			Outcome:   models.OutcomeSuccess,
+			Actor:     "user:" + strconv.Itoa(i),
+			CreatedAt: time.Date(2025, 1, 2, 3, 4, 5, 6000, time.UTC),
+		}
+	}
+	events[len(events)-1].Outcome = models.OutcomeFailure
+
+	return events
+}
+
+// testContext bounds a write like the forwarder does.
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+	t.Cleanup(cancel)
+
+	return ctx
+}
+
+func jsonLine(t *testing.T, event models.AuthEvent) string {
+	t.Helper()
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data) + "\n"
+}
+
+// readSeqs returns the seq of every line of the file at path.
+func readSeqs(t *testing.T, path string) []int64 {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var seqs []int64
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		if !strings.HasSuffix(line, "\n") {
+			t.Fatalf("%s: line %q is not terminated", path, line)
+		}
+		var event models.AuthEvent
+		if err = json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		seqs = append(seqs, event.Seq)
+	}
+
+	return seqs
+}
+
+func TestFileSinkRotation(t *testing.T) {
+	events := testEvents(5)
+	// Every line has the same length, so the size fits exactly two.
+	lineSize := int64(len(jsonLine(t, events[0])))
+
+	tests := []struct {
+		name       string
+		maxSize    int64
+		maxBackups int
+		// want lists the seqs in the file and in each backup, newest first.
+		want [][]int64
+	}{
+		{
+			name:       "exact fit",
+			maxSize:    2 * lineSize,
+			maxBackups: 5,
+			want:       [][]int64{{5}, {3, 4}, {1, 2}},
+		},
+		{
+			name:       "one byte short",
+			maxSize:    2*lineSize - 1,
+			maxBackups: 5,
+			want:       [][]int64{{5}, {4}, {3}, {2}, {1}},
+		},
+		{
+			name:       "backups dropped",
+			maxSize:    2 * lineSize,
+			maxBackups: 1,
+			want:       [][]int64{{5}, {3, 4}},
+		},
+		{
+			name:       "no backups",
+			maxSize:    2 * lineSize,
+			maxBackups: 0,
+			want:       [][]int64{{5}},
+		},
+		{
+			name:       "line longer than the file",
+			maxSize:    1,
+			maxBackups: 5,
+			want:       [][]int64{{5}, {4}, {3}, {2}, {1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.log")
+			s, err := NewFileSink(path, tt.maxSize, tt.maxBackups)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+
+			if err = s.Write(testContext(t), events); err != nil {
+				t.Fatal(err)
+			}
+
+			for i, want := range tt.want {
+				name := path
+				if i > 0 {
+					name = s.backup(i)
+				}
+				if got := readSeqs(t, name); !slices.Equal(got, want) {
+					t.Errorf("%s holds %v, want %v", filepath.Base(name), got, want)
+				}
+			}
+			if _, err = os.Stat(s.backup(len(tt.want))); !os.IsNotExist(err) {
+				t.Errorf("%s exists, want at most %d backups", filepath.Base(s.backup(len(tt.want))),
+					len(tt.want)-1)
+			}
+		})
+	}
+}
+
+func TestFileSinkReopen(t *testing.T) {
+	events := testEvents(3)
+	lineSize := int64(len(jsonLine(t, events[0])))
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	s, err := NewFileSink(path, 2*lineSize, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Write(testContext(t), events[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A reopened file counts the lines already in it.
+	s, err = NewFileSink(path, 2*lineSize, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err = s.Write(testContext(t), events[1:]); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readSeqs(t, path); !slices.Equal(got, []int64{3}) {
+		t.Errorf("file holds %v, want [3]", got)
+	}
+	if got := readSeqs(t, s.backup(1)); !slices.Equal(got, []int64{1, 2}) {
+		t.Errorf("backup holds %v, want [1 2]", got)
+	}
+}
+
+func TestFileSinkRewrite(t *testing.T) {
+	events := testEvents(5)
+	lineSize := int64(len(jsonLine(t, events[0])))
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	s, err := NewFileSink(path, 2*lineSize, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err = s.Write(testContext(t), events[:3]); err != nil {
+		t.Fatal(err)
+	}
+
+	// A batch written again after its position could not be saved.
+	if err = s.Write(testContext(t), events[1:]); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readSeqs(t, path); !slices.Equal(got, []int64{5}) {
+		t.Errorf("file holds %v, want [5]", got)
+	}
+	if got := readSeqs(t, s.backup(1)); !slices.Equal(got, []int64{3, 4}) {
+		t.Errorf("backup holds %v, want [3 4]", got)
+	}
+	if got := readSeqs(t, s.backup(2)); !slices.Equal(got, []int64{1, 2}) {
+		t.Errorf("second backup holds %v, want [1 2]", got)
+	}
+}
+
+func TestFileSinkName(t *testing.T) {
+	dir := t.TempDir()
+
+	a, err := NewFileSink(filepath.Join(dir, "a.log"), 1<<20, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := NewFileSink(filepath.Join(dir, "b.log"), 1<<20, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "file:" + hostname + ":" + filepath.Join(dir, "a.log"); a.Name() != want {
+		t.Errorf("Name() = %q, want %q", a.Name(), want)
+	}
+	if a.Name() == b.Name() {
+		t.Errorf("files share the name %q", a.Name())
+	}
+}
+
+// checkSyslogMessage checks that msg is the RFC 5424 message of event.
+func checkSyslogMessage(t *testing.T, msg []byte, event models.AuthEvent) {
+	t.Helper()
+
+	// <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+	fields := strings.SplitN(string(msg), " ", 8)
+	if len(fields) != 8 {
+		t.Fatalf("message %q has %d fields, want 8", msg, len(fields))
+	}
+
+	severity := severityInfo
+	if event.Outcome == models.OutcomeFailure {
+		severity = severityWarning
+	}
+	hostname, _ := os.Hostname()
+	want := []string{
+		fmt.Sprintf("<%d>1", facilityAuthPriv*8+severity),
+		"2025-01-02T03:04:05.000006Z",
+		hostname,
+		appName,
+		strconv.Itoa(os.Getpid()),
+		event.EventType,
+		"-",
+	}
+	for i, w := range want {
+		if fields[i] != w {
+			t.Errorf("field %d of %q is %q, want %q", i, msg, fields[i], w)
+		}
+	}
+
+	var got models.AuthEvent
+	if err := json.Unmarshal([]byte(fields[7]), &got); err != nil {
+		t.Fatalf("MSG %q: %v", fields[7], err)
+	}
+	if got.Seq != event.Seq || got.Actor != event.Actor {
+		t.Errorf("MSG holds event %d of %s, want %d of %s", got.Seq, got.Actor, event.Seq, event.Actor)
+	}
+}
+
+func TestSyslogSinkUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	s, err := NewSyslogSink("udp://" + conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	events := testEvents(3)
+	if err = s.Write(testContext(t), events); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 64<<10)
+	for _, event := range events {
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkSyslogMessage(t, buf[:n], event)
+	}
+}
+
+func TestSyslogSinkTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			close(received)
+			return
+		}
+		defer conn.Close()
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		data, _ := io.ReadAll(conn)
+		received <- data
+	}()
+
+	s, err := NewSyslogSink("tcp://" + listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := testEvents(3)
+	if err = s.Write(testContext(t), events); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Octet counting (RFC 6587, section 3.4.1): MSG-LEN SP SYSLOG-MSG,
+	// with no delimiter between frames.
+	r := bufio.NewReader(bytes.NewReader(<-received))
+	for _, event := range events {
+		length, err := r.ReadString(' ')
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+		if err != nil {
+			t.Fatalf("frame length %q: %v", length, err)
+		}
+		msg := make([]byte, n)
+		if _, err = io.ReadFull(r, msg); err != nil {
+			t.Fatal(err)
+		}
+		checkSyslogMessage(t, msg, event)
+	}
+	if rest, _ := io.ReadAll(r); len(rest) > 0 {
+		t.Errorf("%d bytes after the last frame", len(rest))
+	}
+}
+
+func TestNATSSink(t *testing.T) {
+	ns, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: server.RANDOM_PORT, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ns.Start()
+	defer ns.Shutdown()
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server did not start")
+	}
+
+	conn, err := nats.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	sub, err := conn.SubscribeSync("audit.>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewNATSSink(ns.ClientURL(), "audit")
+	defer s.Close()
+
+	events := testEvents(3)
+	events[1].EventType = "token.refreshed"
+	if err = s.Write(testContext(t), events); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, event := range events {
+		msg, err := sub.NextMsg(5 * time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "audit." + event.EventType; msg.Subject != want {
+			t.Errorf("subject %q, want %q", msg.Subject, want)
+		}
+		if got := string(msg.Data) + "\n"; got != jsonLine(t, event) {
+			t.Errorf("data %q, want %q", got, jsonLine(t, event))
+		}
+	}
+}
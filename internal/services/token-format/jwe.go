@@ -0,0 +1,253 @@
+package token_format
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+	errors2 "jwt-service/internal/errors"
+	"jwt-service/internal/models"
+	"jwt-service/internal/repository"
+	"os"
+	"strings"
+)
+
+// Nested JWS-in-JWE (RFC 7519, section 11.2): the signed JWT is encrypted
+// with A256GCM to the key registered for its audience, so its claims are
+// readable only by that audience. Tokens without an audience, or for the
+// service's own one, are encrypted to the service's key.
+//
+// The JWT is signed with an RSA or EC key of its own, published in the JWKS
+// of the service, so that an audience can verify the tokens it decrypts
+// without a secret that would let it issue them too.
+
+var (
+	jweKeyAlgorithms = []jose.KeyAlgorithm{
+		jose.RSA_OAEP, jose.RSA_OAEP_256,
+		jose.ECDH_ES, jose.ECDH_ES_A128KW, jose.ECDH_ES_A192KW, jose.ECDH_ES_A256KW,
+	}
+	jweContentEncryption = []jose.ContentEncryption{jose.A256GCM}
+)
+
+type jweFormat struct {
+	privateKey crypto.Signer // *rsa.PrivateKey or *ecdsa.PrivateKey
+	publicKey  jose.JSONWebKey
+	audience   string
+	keys       repository.AudienceKeyRepository
+
+	signingKey    crypto.Signer
+	signingMethod jwt.SigningMethod
+	// verificationKey is the public signing key as published in the JWKS.
+	verificationKey jose.JSONWebKey
+}
+
+// newJWEFormat takes the service's private keys to decrypt and to sign tokens
+// with, which must be different keys.
+func newJWEFormat(privateKey, signingKey crypto.Signer, audience string,
+	keys repository.AudienceKeyRepository) (*jweFormat, error) {
+	publicKey, err := recipientKey(jose.JSONWebKey{Key: privateKey.Public()})
+	if err != nil {
+		return nil, err
+	}
+
+	signingMethod, err := jwsSigningMethod(signingKey)
+	if err != nil {
+		return nil, err
+	}
+
+	verificationKey, err := recipientKey(jose.JSONWebKey{
+		Key:       signingKey.Public(),
+		Algorithm: signingMethod.Alg(),
+		Use:       "sig",
+	})
+	if err != nil {
+		return nil, err
+	}
+	if verificationKey.KeyID == publicKey.KeyID {
+		return nil, errors.New("the signing key must differ from the encryption key")
+	}
+
+	return &jweFormat{
+		privateKey:      privateKey,
+		publicKey:       publicKey,
+		audience:        audience,
+		keys:            keys,
+		signingKey:      signingKey,
+		signingMethod:   signingMethod,
+		verificationKey: verificationKey,
+	}, nil
+}
+
+func (f *jweFormat) Issue(ctx context.Context, claims *models.AccessClaims) (string, error) {
+	key, err := f.audienceKey(ctx, claims.Audience)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(f.signingMethod, claims)
+	token.Header["kid"] = f.verificationKey.KeyID
+	signed, err := token.SignedString(f.signingKey)
+	if err != nil {
+		return "", err
+	}
+
+	alg := jose.ECDH_ES
+	if _, ok := key.Key.(*rsa.PublicKey); ok {
+		alg = jose.RSA_OAEP
+	}
+
+	encrypter, err := jose.NewEncrypter(jose.A256GCM,
+		jose.Recipient{Algorithm: alg, Key: key.Key, KeyID: key.KeyID},
+		(&jose.EncrypterOptions{}).WithContentType("JWT"))
+	if err != nil {
+		return "", err
+	}
+
+	object, err := encrypter.Encrypt([]byte(signed))
+	if err != nil {
+		return "", err
+	}
+
+	return object.CompactSerialize()
+}
+
+func (f *jweFormat) Parse(token string) (*models.AccessClaims, error) {
+	object, err := jose.ParseEncryptedCompact(token, jweKeyAlgorithms, jweContentEncryption)
+	if err != nil {
+		return nil, errors2.ErrInvalidToken
+	}
+	if cty, _ := object.Header.ExtraHeaders[jose.HeaderContentType].(string); !strings.EqualFold(cty, "JWT") {
+		return nil, errors2.ErrInvalidToken
+	}
+
+	signed, err := object.Decrypt(f.privateKey)
+	if err != nil {
+		return nil, errors2.ErrInvalidToken
+	}
+
+	claims := &models.AccessClaims{}
+	jws, err := jwt.ParseWithClaims(string(signed), claims, func(jws *jwt.Token) (interface{}, error) {
+		if kid, _ := jws.Header["kid"].(string); kid != f.verificationKey.KeyID {
+			return nil, errors2.ErrInvalidToken
+		}
+
+		return f.verificationKey.Key, nil
+	}, jwt.WithValidMethods([]string{f.signingMethod.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || !jws.Valid {
+		return nil, errors2.ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+// jwsSigningMethod returns the algorithm to sign with key: RS256 for RSA
+// keys, the ECDSA algorithm of its curve for EC keys.
+func jwsSigningMethod(key crypto.Signer) (jwt.SigningMethod, error) {
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return jwt.SigningMethodRS256, nil
+	case *ecdsa.PrivateKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return jwt.SigningMethodES256, nil
+		case elliptic.P384():
+			return jwt.SigningMethodES384, nil
+		case elliptic.P521():
+			return jwt.SigningMethodES512, nil
+		}
+		return nil, fmt.Errorf("unsupported curve %s", key.Curve.Params().Name)
+	default:
+		return nil, fmt.Errorf("unsupported signing key type %T", key)
+	}
+}
+
+// audienceKey returns the key to encrypt a token for aud to. A JWE has a
+// single recipient, so the token may have at most one audience.
+func (f *jweFormat) audienceKey(ctx context.Context, aud []string) (jose.JSONWebKey, error) {
+	if len(aud) > 1 {
+		return jose.JSONWebKey{}, errors.New("encrypted tokens must have a single audience")
+	}
+	if len(aud) == 0 || aud[0] == f.audience {
+		return f.publicKey, nil
+	}
+
+	registered, err := f.keys.GetAudienceKey(ctx, aud[0])
+	if err != nil {
+		return jose.JSONWebKey{}, fmt.Errorf("%w: %q", errors2.ErrAudienceKeyNotFound, aud[0])
+	}
+
+	var key jose.JSONWebKey
+	if err = key.UnmarshalJSON(registered.JWK); err != nil {
+		return jose.JSONWebKey{}, fmt.Errorf("key of audience %q: %w", aud[0], err)
+	}
+	if !key.IsPublic() {
+		return jose.JSONWebKey{}, fmt.Errorf("key of audience %q is not a public key", aud[0])
+	}
+
+	return recipientKey(key)
+}
+
+// recipientKey checks that key is an RSA or EC public key and identifies it
+// by its RFC 7638 thumbprint unless it already has a key ID.
+func recipientKey(key jose.JSONWebKey) (jose.JSONWebKey, error) {
+	switch key.Key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return jose.JSONWebKey{}, fmt.Errorf("unsupported encryption key type %T", key.Key)
+	}
+	if key.KeyID != "" {
+		return key, nil
+	}
+
+	thumbprint, err := key.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return jose.JSONWebKey{}, err
+	}
+	key.KeyID = base64.RawURLEncoding.EncodeToString(thumbprint)
+
+	return key, nil
+}
+
+// readPrivateKey reads an RSA or EC private key from a PEM file.
+func readPrivateKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePrivateKey(data)
+}
+
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		switch key := key.(type) {
+		case *rsa.PrivateKey:
+			return key, nil
+		case *ecdsa.PrivateKey:
+			return key, nil
+		default:
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	return nil, errors.New("unsupported private key encoding")
+}
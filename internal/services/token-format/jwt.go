@@ -0,0 +1,62 @@
+package token_format
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	errors2 "jwt-service/internal/errors"
+	"jwt-service/internal/models"
+)
+
+type jwtFormat struct {
+	keys *keyring
+}
+
+func newJWTFormat(keys *keyring) *jwtFormat {
+	return &jwtFormat{keys: keys}
+}
+
+func (f *jwtFormat) Issue(ctx context.Context, claims *models.AccessClaims) (string, error) {
+	kid, secret, err := f.keys.signingKey()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	return token.SignedString(secret)
+}
+
+// Parse returns errors2.ErrInternalServerError if the keys could not be
+// loaded, and errors2.ErrInvalidToken for any other failure.
+func (f *jwtFormat) Parse(tokenStr string) (*models.AccessClaims, error) {
+	claims := &models.AccessClaims{}
+	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS512 {
+			return nil, errors2.ErrUnexpectedHashMethod
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		secret, ok, err := f.keys.verificationKey(kid)
+		if err != nil {
+			return nil, fmt.Errorf("%w: load signing keys: %w", errors2.ErrInternalServerError, err)
+		}
+		if !ok {
+			return nil, errors2.ErrInvalidToken
+		}
+
+		return secret, nil
+	}, jwt.WithExpirationRequired())
+	if errors.Is(err, errors2.ErrInternalServerError) {
+		return nil, err
+	}
+	if err != nil || !token.Valid {
+		return nil, errors2.ErrInvalidToken
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,58 @@
+package token_format
+
+import (
+	"context"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	errors2 "jwt-service/internal/errors"
+	"jwt-service/internal/models"
+	"jwt-service/internal/repository"
+	"testing"
+	"time"
+)
+
+// keyStore serves a fixed keyring, or err once it is set.
+type keyStore struct {
+	repository.SecurityRepository
+	keys []models.SigningKey
+	err  error
+}
+
+func (s *keyStore) GetSigningKeys(ctx context.Context) ([]models.SigningKey, error) {
+	return s.keys, s.err
+}
+
+func TestJWTParseKeyErrors(t *testing.T) {
+	store := &keyStore{keys: []models.SigningKey{{KID: "k1", Secret: []byte("secret-1")}}}
+	keys, err := newKeyring(store, []byte("fallback"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := newJWTFormat(keys)
+
+	token, err := f.Issue(context.Background(), &models.AccessClaims{RegisteredClaims: jwt.RegisteredClaims{
+		Subject:   "user-1",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.Parse(token); err != nil {
+		t.Fatalf("Parse() = %v", err)
+	}
+
+	// The key is unknown once the keyring is reloaded without it.
+	store.keys = []models.SigningKey{{KID: "k2", Secret: []byte("secret-2")}}
+	keys.loadedAt = time.Time{}
+	if _, err = f.Parse(token); !errors.Is(err, errors2.ErrInvalidToken) {
+		t.Errorf("Parse() with an unknown kid = %v, want %v", err, errors2.ErrInvalidToken)
+	}
+
+	// A database outage is not the client's fault.
+	store.err = errors.New("connection refused")
+	keys.loadedAt = time.Time{}
+	_, err = f.Parse(token)
+	if !errors.Is(err, errors2.ErrInternalServerError) || errors.Is(err, errors2.ErrInvalidToken) {
+		t.Errorf("Parse() with the keys unavailable = %v, want %v", err, errors2.ErrInternalServerError)
+	}
+}
@@ -0,0 +1,137 @@
+package token_format
+
+import (
+	"context"
+	"jwt-service/internal/models"
+	"jwt-service/internal/repository"
+	"sync"
+	"time"
+)
+
+// keyringTTL bounds how long another instance of the service keeps signing
+// with, and accepting, a key after it was rotated out. An unknown kid may be
+// a key added by another instance and triggers a reload, at most once per
+// missReloadInterval.
+const (
+	keyringTTL         = 5 * time.Second
+	missReloadInterval = time.Second
+)
+
+// keyring holds the HS512 keys of the jwt format. Until the first rotation
+// it is empty and tokens are signed with JWT_SECRET and carry no kid. After
+// that JWT_SECRET is no longer accepted, as it may be the compromised key.
+type keyring struct {
+	repo repository.SecurityRepository
+
+	mu       sync.Mutex
+	fallback []byte
+	keys     []models.SigningKey
+	loadedAt time.Time
+}
+
+func newKeyring(repo repository.SecurityRepository, fallback []byte) (*keyring, error) {
+	k := &keyring{
+		repo:     repo,
+		fallback: fallback,
+	}
+
+	return k, k.reload(context.Background())
+}
+
+// setFallback replaces JWT_SECRET after the configuration was reloaded.
+func (k *keyring) setFallback(fallback []byte) {
+	k.mu.Lock()
+	k.fallback = fallback
+	k.mu.Unlock()
+}
+
+func (k *keyring) reload(ctx context.Context) error {
+	keys, err := k.repo.GetSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.loadedAt = time.Now()
+	k.mu.Unlock()
+
+	return nil
+}
+
+// current returns the keys and JWT_SECRET.
+func (k *keyring) current() ([]models.SigningKey, []byte, error) {
+	k.mu.Lock()
+	stale := time.Since(k.loadedAt) > keyringTTL
+	k.mu.Unlock()
+
+	// Reloads refresh a cache shared by all requests, so they are not
+	// traced as part of the one that happens to trigger them.
+	if stale {
+		if err := k.reload(context.Background()); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return k.keys, k.fallback, nil
+}
+
+// signingKey returns the key to sign new tokens with and its kid.
+func (k *keyring) signingKey() (string, []byte, error) {
+	keys, fallback, err := k.current()
+	if err != nil {
+		return "", nil, err
+	}
+	if len(keys) == 0 {
+		return "", fallback, nil
+	}
+
+	return keys[0].KID, keys[0].Secret, nil
+}
+
+// verificationKey returns the key with the given kid, ok is false if there
+// is no such key or it was retired.
+func (k *keyring) verificationKey(kid string) ([]byte, bool, error) {
+	keys, fallback, err := k.current()
+	if err != nil {
+		return nil, false, err
+	}
+	if kid == "" {
+		return fallback, len(keys) == 0, nil
+	}
+
+	if secret, ok := findKey(keys, kid); ok {
+		return secret, true, nil
+	}
+
+	k.mu.Lock()
+	recent := time.Since(k.loadedAt) < missReloadInterval
+	k.mu.Unlock()
+	if recent {
+		return nil, false, nil
+	}
+
+	if err = k.reload(context.Background()); err != nil {
+		return nil, false, err
+	}
+	keys, _, err = k.current()
+	if err != nil {
+		return nil, false, err
+	}
+	secret, ok := findKey(keys, kid)
+
+	return secret, ok, nil
+}
+
+func findKey(keys []models.SigningKey, kid string) ([]byte, bool) {
+	for _, key := range keys {
+		if key.KID == kid {
+			return key.Secret, true
+		}
+	}
+
+	return nil, false
+}
@@ -0,0 +1,309 @@
+package token_format
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20"
+	errors2 "jwt-service/internal/errors"
+	"jwt-service/internal/models"
+	"slices"
+	"strings"
+	"time"
+)
+
+// PASETO version 4 (https://github.com/paseto-standard/paseto-spec).
+// Registered time claims are RFC 3339 strings in PASETO, so they are
+// converted from and to the NumericDate values used by AccessClaims.
+
+var pasetoTimeClaims = []string{"exp", "iat", "nbf"}
+
+type pasetoPublicFormat struct {
+	secretKey ed25519.PrivateKey
+}
+
+// newPasetoPublicFormat accepts a hex-encoded Ed25519 seed or private key.
+func newPasetoPublicFormat(hexKey string) (*pasetoPublicFormat, error) {
+	key, err := hex.DecodeString(hexKey)
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(key) {
+	case ed25519.SeedSize:
+		return &pasetoPublicFormat{secretKey: ed25519.NewKeyFromSeed(key)}, nil
+	case ed25519.PrivateKeySize:
+		return &pasetoPublicFormat{secretKey: key}, nil
+	default:
+		return nil, errors.New("expected a 32-byte seed or a 64-byte Ed25519 private key")
+	}
+}
+
+func (f *pasetoPublicFormat) Issue(ctx context.Context, claims *models.AccessClaims) (string, error) {
+	m, err := encodePasetoClaims(claims)
+	if err != nil {
+		return "", err
+	}
+
+	return f.sign(m, nil, nil), nil
+}
+
+func (f *pasetoPublicFormat) Parse(token string) (*models.AccessClaims, error) {
+	m, err := f.verify(token, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodePasetoClaims(m)
+}
+
+const pasetoPublicHeader = "v4.public."
+
+// sign returns the v4.public token of the message m with the footer and
+// the implicit assertion.
+func (f *pasetoPublicFormat) sign(m, footer, implicit []byte) string {
+	sig := ed25519.Sign(f.secretKey, pae([]byte(pasetoPublicHeader), m, footer, implicit))
+
+	return joinPaseto(pasetoPublicHeader, slices.Concat(m, sig), footer)
+}
+
+// verify returns the message of the v4.public token signed with the
+// implicit assertion.
+func (f *pasetoPublicFormat) verify(token string, implicit []byte) ([]byte, error) {
+	payload, footer, err := splitPaseto(token, pasetoPublicHeader)
+	if err != nil || len(payload) < ed25519.SignatureSize {
+		return nil, errors2.ErrInvalidToken
+	}
+
+	m, sig := payload[:len(payload)-ed25519.SignatureSize], payload[len(payload)-ed25519.SignatureSize:]
+	publicKey := f.secretKey.Public().(ed25519.PublicKey)
+	if !ed25519.Verify(publicKey, pae([]byte(pasetoPublicHeader), m, footer, implicit), sig) {
+		return nil, errors2.ErrInvalidToken
+	}
+
+	return m, nil
+}
+
+type pasetoLocalFormat struct {
+	key []byte
+}
+
+// newPasetoLocalFormat accepts a hex-encoded 256-bit symmetric key.
+func newPasetoLocalFormat(hexKey string) (*pasetoLocalFormat, error) {
+	key, err := hex.DecodeString(hexKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, errors.New("expected a 32-byte key")
+	}
+
+	return &pasetoLocalFormat{key: key}, nil
+}
+
+func (f *pasetoLocalFormat) Issue(ctx context.Context, claims *models.AccessClaims) (string, error) {
+	m, err := encodePasetoClaims(claims)
+	if err != nil {
+		return "", err
+	}
+
+	n := make([]byte, 32)
+	if _, err = rand.Read(n); err != nil {
+		return "", err
+	}
+
+	return f.encrypt(n, m, nil, nil)
+}
+
+func (f *pasetoLocalFormat) Parse(token string) (*models.AccessClaims, error) {
+	m, err := f.decrypt(token, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodePasetoClaims(m)
+}
+
+const pasetoLocalHeader = "v4.local."
+
+// encrypt returns the v4.local token of the message m with the nonce n, the
+// footer and the implicit assertion.
+func (f *pasetoLocalFormat) encrypt(n, m, footer, implicit []byte) (string, error) {
+	encKey, nonce, authKey := f.splitKey(n)
+	cipher, err := chacha20.NewUnauthenticatedCipher(encKey, nonce)
+	if err != nil {
+		return "", err
+	}
+	c := make([]byte, len(m))
+	cipher.XORKeyStream(c, m)
+
+	t := blake2bMAC(authKey, 32, pae([]byte(pasetoLocalHeader), n, c, footer, implicit))
+
+	return joinPaseto(pasetoLocalHeader, slices.Concat(n, c, t), footer), nil
+}
+
+// decrypt returns the message of the v4.local token encrypted with the
+// implicit assertion.
+func (f *pasetoLocalFormat) decrypt(token string, implicit []byte) ([]byte, error) {
+	payload, footer, err := splitPaseto(token, pasetoLocalHeader)
+	if err != nil || len(payload) < 64 {
+		return nil, errors2.ErrInvalidToken
+	}
+
+	n, c, t := payload[:32], payload[32:len(payload)-32], payload[len(payload)-32:]
+	encKey, nonce, authKey := f.splitKey(n)
+
+	expected := blake2bMAC(authKey, 32, pae([]byte(pasetoLocalHeader), n, c, footer, implicit))
+	if subtle.ConstantTimeCompare(t, expected) != 1 {
+		return nil, errors2.ErrInvalidToken
+	}
+
+	cipher, err := chacha20.NewUnauthenticatedCipher(encKey, nonce)
+	if err != nil {
+		return nil, errors2.ErrInvalidToken
+	}
+	m := make([]byte, len(c))
+	cipher.XORKeyStream(m, c)
+
+	return m, nil
+}
+
+// splitKey derives the encryption key, the XChaCha20 nonce and the
+// authentication key from the symmetric key and the token nonce n.
+func (f *pasetoLocalFormat) splitKey(n []byte) ([]byte, []byte, []byte) {
+	tmp := blake2bMAC(f.key, 56, append([]byte("paseto-encryption-key"), n...))
+	authKey := blake2bMAC(f.key, 32, append([]byte("paseto-auth-key-for-aead"), n...))
+
+	return tmp[:32], tmp[32:], authKey
+}
+
+func blake2bMAC(key []byte, size int, msg []byte) []byte {
+	h, err := blake2b.New(size, key)
+	if err != nil {
+		// Only reachable with an invalid size or a key over 64 bytes.
+		panic(err)
+	}
+	h.Write(msg)
+
+	return h.Sum(nil)
+}
+
+// pae is the PASETO pre-authentication encoding of pieces.
+func pae(pieces ...[]byte) []byte {
+	var buf bytes.Buffer
+	le64 := func(n int) {
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], uint64(n)&(1<<63-1))
+		buf.Write(b[:])
+	}
+
+	le64(len(pieces))
+	for _, p := range pieces {
+		le64(len(p))
+		buf.Write(p)
+	}
+
+	return buf.Bytes()
+}
+
+// joinPaseto encodes a token, which has a footer only if it is not empty.
+func joinPaseto(header string, payload, footer []byte) string {
+	token := header + base64.RawURLEncoding.EncodeToString(payload)
+	if len(footer) > 0 {
+		token += "." + base64.RawURLEncoding.EncodeToString(footer)
+	}
+
+	return token
+}
+
+func splitPaseto(token, header string) ([]byte, []byte, error) {
+	body, ok := strings.CutPrefix(token, header)
+	if !ok {
+		return nil, nil, errors2.ErrInvalidToken
+	}
+
+	// Unused bits of the last character must be zero, or several strings
+	// would decode to the same token.
+	encoding := base64.RawURLEncoding.Strict()
+	rawPayload, rawFooter, _ := strings.Cut(body, ".")
+	payload, err := encoding.DecodeString(rawPayload)
+	if err != nil {
+		return nil, nil, err
+	}
+	footer, err := encoding.DecodeString(rawFooter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return payload, footer, nil
+}
+
+func encodePasetoClaims(claims *models.AccessClaims) ([]byte, error) {
+	raw, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]interface{}
+	if err = json.Unmarshal(raw, &m); err != nil {
+		return nil, err
+	}
+
+	for _, name := range pasetoTimeClaims {
+		if v, ok := m[name].(float64); ok {
+			m[name] = time.Unix(int64(v), 0).UTC().Format(time.RFC3339)
+		}
+	}
+	if aud, ok := m["aud"].([]interface{}); ok && len(aud) == 1 {
+		m["aud"] = aud[0]
+	}
+
+	return json.Marshal(m)
+}
+
+func decodePasetoClaims(payload []byte) (*models.AccessClaims, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal(payload, &m); err != nil {
+		return nil, errors2.ErrInvalidToken
+	}
+
+	for _, name := range pasetoTimeClaims {
+		v, ok := m[name]
+		if !ok {
+			continue
+		}
+		s, _ := v.(string)
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, errors2.ErrInvalidToken
+		}
+		m[name] = t.Unix()
+	}
+
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return nil, errors2.ErrInvalidToken
+	}
+	claims := &models.AccessClaims{}
+	if err = json.Unmarshal(raw, claims); err != nil {
+		return nil, errors2.ErrInvalidToken
+	}
+
+	now := time.Now()
+	if claims.ExpiresAt == nil || now.After(claims.ExpiresAt.Time) {
+		return nil, errors2.ErrInvalidToken
+	}
+	if claims.NotBefore != nil && now.Before(claims.NotBefore.Time) {
+		return nil, errors2.ErrInvalidToken
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,114 @@
+package token_format
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+// pasetoVector is a test of testdata/paseto-v4.json, the v4 test vectors of
+// the PASETO specification (https://github.com/paseto-standard/test-vectors).
+type pasetoVector struct {
+	Name       string `json:"name"`
+	ExpectFail bool   `json:"expect-fail"`
+	// Key and Nonce are set for v4.local, SecretKey and PublicKey for
+	// v4.public.
+	Key       string  `json:"key"`
+	Nonce     string  `json:"nonce"`
+	SecretKey string  `json:"secret-key"`
+	PublicKey string  `json:"public-key"`
+	Token     string  `json:"token"`
+	Payload   *string `json:"payload"`
+	Footer    string  `json:"footer"`
+	Implicit  string  `json:"implicit-assertion"`
+}
+
+func pasetoVectors(t *testing.T) []pasetoVector {
+	t.Helper()
+
+	data, err := os.ReadFile("testdata/paseto-v4.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var file struct {
+		Tests []pasetoVector `json:"tests"`
+	}
+	if err = json.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+	if len(file.Tests) == 0 {
+		t.Fatal("no test vectors")
+	}
+
+	return file.Tests
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func TestPasetoVectors(t *testing.T) {
+	for _, v := range pasetoVectors(t) {
+		t.Run(v.Name, func(t *testing.T) {
+			footer, implicit := []byte(v.Footer), []byte(v.Implicit)
+
+			var (
+				m   []byte
+				err error
+			)
+			switch {
+			case v.Key != "":
+				f, ferr := newPasetoLocalFormat(v.Key)
+				if ferr != nil {
+					t.Fatal(ferr)
+				}
+				if !v.ExpectFail {
+					token, eerr := f.encrypt(mustHex(t, v.Nonce), []byte(*v.Payload), footer, implicit)
+					if eerr != nil {
+						t.Fatal(eerr)
+					}
+					if token != v.Token {
+						t.Errorf("encrypt() = %q, want %q", token, v.Token)
+					}
+				}
+				m, err = f.decrypt(v.Token, implicit)
+			case v.SecretKey != "":
+				f, ferr := newPasetoPublicFormat(v.SecretKey)
+				if ferr != nil {
+					t.Fatal(ferr)
+				}
+				if got := hex.EncodeToString(f.secretKey.Public().(ed25519.PublicKey)); got != v.PublicKey {
+					t.Fatalf("public key %s, want %s", got, v.PublicKey)
+				}
+				if !v.ExpectFail {
+					if token := f.sign([]byte(*v.Payload), footer, implicit); token != v.Token {
+						t.Errorf("sign() = %q, want %q", token, v.Token)
+					}
+				}
+				m, err = f.verify(v.Token, implicit)
+			default:
+				t.Fatal("vector has no key")
+			}
+
+			switch {
+			case v.ExpectFail && err == nil:
+				t.Errorf("token accepted with message %q", m)
+			case v.ExpectFail:
+			case err != nil:
+				t.Errorf("token rejected: %v", err)
+			case string(m) != *v.Payload:
+				t.Errorf("message %q, want %q", m, *v.Payload)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package token_format
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-jose/go-jose/v4"
+	"jwt-service/internal/config"
+	errors2 "jwt-service/internal/errors"
+	"jwt-service/internal/models"
+	"jwt-service/internal/repository"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	FormatJWT          = "jwt"
+	FormatPasetoPublic = "v4.public"
+	FormatPasetoLocal  = "v4.local"
+	FormatJWE          = "jwe"
+)
+
+// TokenFormat encodes access token claims into a token string and back.
+type TokenFormat interface {
+	Issue(ctx context.Context, claims *models.AccessClaims) (string, error)
+	// Parse authenticates the token and checks that it has not expired.
+	Parse(token string) (*models.AccessClaims, error)
+}
+
+// Formats holds the access token formats the service can issue and accept.
+// A format is available only if its keys are configured.
+type Formats struct {
+	keys         *keyring
+	jwt          *jwtFormat
+	audienceKeys repository.AudienceKeyRepository
+
+	// set is swapped as a whole when the configuration is reloaded.
+	set atomic.Pointer[formatSet]
+}
+
+type formatSet struct {
+	formats       map[string]TokenFormat
+	defaultFormat string
+	// staticKeys names the configured keys of the set, which are not in
+	// signing_keys and so are not rotated by the kill switch.
+	staticKeys []string
+	// jwks holds the public keys others verify the tokens of the set with.
+	jwks jose.JSONWebKeySet
+}
+
+func New(cfg *config.Config, audienceKeys repository.AudienceKeyRepository,
+	security repository.SecurityRepository) (*Formats, error) {
+	keys, err := newKeyring(security, []byte(cfg.JWTSecret))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing keys: %w", err)
+	}
+
+	f := &Formats{
+		keys:         keys,
+		jwt:          newJWTFormat(keys),
+		audienceKeys: audienceKeys,
+	}
+
+	set, err := f.newSet(cfg)
+	if err != nil {
+		return nil, err
+	}
+	f.set.Store(set)
+
+	return f, nil
+}
+
+// PrepareReload loads the keys of cfg, so that rotated keys and a changed
+// default format take effect without a restart.
+func (f *Formats) PrepareReload(_ context.Context, cfg *config.Config) (func(), error) {
+	set, err := f.newSet(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		f.keys.setFallback([]byte(cfg.JWTSecret))
+		f.set.Store(set)
+	}, nil
+}
+
+func (f *Formats) newSet(cfg *config.Config) (*formatSet, error) {
+	set := &formatSet{
+		formats: map[string]TokenFormat{
+			FormatJWT: f.jwt,
+		},
+		defaultFormat: cfg.AccessTokenFormat,
+		jwks:          jose.JSONWebKeySet{Keys: []jose.JSONWebKey{}},
+	}
+
+	if cfg.PasetoSecretKey != "" {
+		public, err := newPasetoPublicFormat(cfg.PasetoSecretKey)
+		if err != nil {
+			return nil, fmt.Errorf("PASETO_SECRET_KEY: %w", err)
+		}
+		set.formats[FormatPasetoPublic] = public
+		set.staticKeys = append(set.staticKeys, "PASETO_SECRET_KEY")
+	}
+	if cfg.PasetoLocalKey != "" {
+		local, err := newPasetoLocalFormat(cfg.PasetoLocalKey)
+		if err != nil {
+			return nil, fmt.Errorf("PASETO_LOCAL_KEY: %w", err)
+		}
+		set.formats[FormatPasetoLocal] = local
+		set.staticKeys = append(set.staticKeys, "PASETO_LOCAL_KEY")
+	}
+	if cfg.JWEPrivateKeyFile != "" {
+		privateKey, err := readPrivateKey(cfg.JWEPrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("JWE_PRIVATE_KEY_FILE: %w", err)
+		}
+		signingKey, err := readPrivateKey(cfg.JWESigningKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("JWE_SIGNING_KEY_FILE: %w", err)
+		}
+		jwe, err := newJWEFormat(privateKey, signingKey, cfg.Audience, f.audienceKeys)
+		if err != nil {
+			return nil, fmt.Errorf("jwe: %w", err)
+		}
+		set.formats[FormatJWE] = jwe
+		set.staticKeys = append(set.staticKeys, "JWE_SIGNING_KEY_FILE")
+		set.jwks.Keys = append(set.jwks.Keys, jwe.verificationKey)
+	}
+
+	if _, ok := set.formats[set.defaultFormat]; !ok {
+		return nil, fmt.Errorf("ACCESS_TOKEN_FORMAT: %w: %q", errors2.ErrUnknownTokenFormat, set.defaultFormat)
+	}
+
+	return set, nil
+}
+
+// ReloadKeys reloads the signing keys of the jwt format, so a
+// rotation takes effect on this instance at once.
+func (f *Formats) ReloadKeys(ctx context.Context) error {
+	return f.keys.reload(ctx)
+}
+
+// StaticKeys returns the names of the configured PASETO and JWE keys. Unlike
+// the HS512 keys they come from the configuration, so only whoever manages it
+// can replace them.
+func (f *Formats) StaticKeys() []string {
+	return f.set.Load().staticKeys
+}
+
+// JWKS returns the public keys of the formats that can be verified without
+// the service's secrets, currently only jwe.
+func (f *Formats) JWKS() jose.JSONWebKeySet {
+	return f.set.Load().jwks
+}
+
+// SigningKey returns the HS512 key new jwt tokens are signed with and its
+// kid, empty for JWT_SECRET.
+func (f *Formats) SigningKey() (string, []byte, error) {
+	return f.keys.signingKey()
+}
+
+// Get returns the named format, or the default format if name is empty.
+func (f *Formats) Get(name string) (TokenFormat, error) {
+	set := f.set.Load()
+	if name == "" {
+		name = set.defaultFormat
+	}
+
+	format, ok := set.formats[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", errors2.ErrUnknownTokenFormat, name)
+	}
+
+	return format, nil
+}
+
+// Detect returns the name of the format token is encoded in. PASETO tokens
+// carry their version and purpose as a prefix, a JWE has five segments where
+// a JWS has three, anything else is a JWT.
+func (f *Formats) Detect(token string) string {
+	switch {
+	case strings.HasPrefix(token, FormatPasetoPublic+"."):
+		return FormatPasetoPublic
+	case strings.HasPrefix(token, FormatPasetoLocal+"."):
+		return FormatPasetoLocal
+	case strings.Count(token, ".") == 4:
+		return FormatJWE
+	default:
+		return FormatJWT
+	}
+}
+
+// Parse parses a token in any available format. It returns
+// errors2.ErrInternalServerError if the keys to check it with could not be
+// loaded.
+func (f *Formats) Parse(token string) (*models.AccessClaims, error) {
+	format, ok := f.set.Load().formats[f.Detect(token)]
+	if !ok {
+		return nil, errors2.ErrInvalidToken
+	}
+
+	return format.Parse(token)
+}
@@ -0,0 +1,88 @@
+package token_version
+
+import (
+	"context"
+	"jwt-service/internal/repository"
+	"sync"
+	"time"
+)
+
+// cacheTTL bounds how long another instance of the service may keep
+// accepting tokens after a user's version was bumped.
+const cacheTTL = 5 * time.Second
+
+type TokenVersions interface {
+	// Current returns the user's token version, cached for a short while.
+	Current(ctx context.Context, userID string) (int64, error)
+	// Bump increments the user's token version, invalidating every access
+	// token issued to them so far.
+	Bump(ctx context.Context, userID string) (int64, error)
+}
+
+type cacheEntry struct {
+	version   int64
+	expiresAt time.Time
+}
+
+type TokenVersionsImpl struct {
+	repo repository.JWTRepository
+
+	mu        sync.Mutex
+	cache     map[string]cacheEntry
+	lastPrune time.Time
+}
+
+func New(repo repository.JWTRepository) *TokenVersionsImpl {
+	return &TokenVersionsImpl{
+		repo:      repo,
+		cache:     make(map[string]cacheEntry),
+		lastPrune: time.Now(),
+	}
+}
+
+func (t *TokenVersionsImpl) Current(ctx context.Context, userID string) (int64, error) {
+	now := time.Now()
+
+	t.mu.Lock()
+	entry, ok := t.cache[userID]
+	t.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.version, nil
+	}
+
+	version, err := t.repo.GetTokenVersion(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if now.Sub(t.lastPrune) > time.Minute {
+		for k, e := range t.cache {
+			if now.After(e.expiresAt) {
+				delete(t.cache, k)
+			}
+		}
+		t.lastPrune = now
+	}
+	// A concurrent Bump may have cached a newer version in the meantime.
+	if cached, ok := t.cache[userID]; !ok || cached.version <= version {
+		t.cache[userID] = cacheEntry{version: version, expiresAt: now.Add(cacheTTL)}
+	}
+
+	return version, nil
+}
+
+func (t *TokenVersionsImpl) Bump(ctx context.Context, userID string) (int64, error) {
+	version, err := t.repo.BumpTokenVersion(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	t.mu.Lock()
+	t.cache[userID] = cacheEntry{version: version, expiresAt: time.Now().Add(cacheTTL)}
+	t.mu.Unlock()
+
+	return version, nil
+}
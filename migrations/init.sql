@@ -15,3 +15,199 @@ CREATE TABLE IF NOT EXISTS jwt_blacklist (
     jti TEXT PRIMARY KEY,
     blacklisted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
+
+CREATE TABLE IF NOT EXISTS oauth_clients (
+    client_id     TEXT PRIMARY KEY,
+    name          TEXT NOT NULL,
+    redirect_uris TEXT[] NOT NULL DEFAULT '{}',
+    created_at    TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS oauth_codes (
+    code_hash      TEXT PRIMARY KEY,
+    client_id      TEXT NOT NULL REFERENCES oauth_clients(client_id) ON DELETE CASCADE,
+    user_id        UUID NOT NULL,
+    redirect_uri   TEXT NOT NULL,
+    code_challenge TEXT NOT NULL,
+    expires_at     TIMESTAMP NOT NULL,
+    used           BOOLEAN DEFAULT FALSE
+);
+
+CREATE INDEX IF NOT EXISTS idx_oauth_codes_expires_at ON oauth_codes(expires_at);
+
+CREATE TABLE IF NOT EXISTS oauth_device_codes (
+    device_code_hash TEXT PRIMARY KEY,
+    user_code        TEXT NOT NULL UNIQUE,
+    client_id        TEXT NOT NULL REFERENCES oauth_clients(client_id) ON DELETE CASCADE,
+    user_id          UUID,
+    status           VARCHAR(16) NOT NULL DEFAULT 'pending',
+    interval_seconds INTEGER NOT NULL,
+    expires_at       TIMESTAMP NOT NULL,
+    last_polled_at   TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_oauth_device_codes_expires_at ON oauth_device_codes(expires_at);
+
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS client_secret_hash TEXT;
+
+CREATE TABLE IF NOT EXISTS token_exchange_policies (
+    client_id       TEXT NOT NULL REFERENCES oauth_clients(client_id) ON DELETE CASCADE,
+    audience        TEXT NOT NULL,
+    scopes          TEXT[] NOT NULL DEFAULT '{}',
+    max_ttl_seconds INTEGER NOT NULL DEFAULT 300,
+    actor_required  BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (client_id, audience)
+);
+
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS jkt TEXT;
+
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS x5t TEXT;
+
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS token_format TEXT;
+
+CREATE TABLE IF NOT EXISTS audience_keys (
+    audience   TEXT PRIMARY KEY,
+    jwk        JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS session_id UUID;
+
+CREATE INDEX IF NOT EXISTS idx_refresh_session_id ON refresh_tokens(session_id);
+
+CREATE TABLE IF NOT EXISTS user_token_versions (
+    user_id    TEXT PRIMARY KEY,
+    version    BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS security_settings (
+    id               BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    token_not_before TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS signing_keys (
+    kid        TEXT PRIMARY KEY,
+    secret     BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    retired_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS admin_actions (
+    id         BIGSERIAL PRIMARY KEY,
+    action     TEXT NOT NULL,
+    actor      TEXT NOT NULL,
+    reason     TEXT NOT NULL,
+    details    JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id              BIGSERIAL PRIMARY KEY,
+    event_type      TEXT NOT NULL,
+    target          TEXT NOT NULL,
+    payload         JSONB NOT NULL,
+    status          VARCHAR(16) NOT NULL DEFAULT 'pending',
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_error      TEXT,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    delivered_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_due ON outbox_events(next_attempt_at) WHERE status = 'pending';
+
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id          UUID PRIMARY KEY,
+    url         TEXT NOT NULL,
+    secret      TEXT NOT NULL,
+    event_types TEXT[] NOT NULL DEFAULT '{}',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE outbox_events ADD COLUMN IF NOT EXISTS subscription_id UUID
+    REFERENCES webhook_subscriptions(id) ON DELETE CASCADE;
+
+CREATE TABLE IF NOT EXISTS auth_events (
+    id         BIGSERIAL PRIMARY KEY,
+    event_type TEXT NOT NULL,
+    outcome    VARCHAR(16) NOT NULL,
+    actor      TEXT NOT NULL,
+    subject    TEXT NOT NULL DEFAULT '',
+    client_id  TEXT NOT NULL DEFAULT '',
+    session_id TEXT NOT NULL DEFAULT '',
+    ip         TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    reason     TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_events_subject ON auth_events(subject, id);
+
+-- The audit log is append-only.
+CREATE OR REPLACE FUNCTION reject_auth_events_change() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'auth_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE TRIGGER auth_events_append_only
+    BEFORE UPDATE OR DELETE OR TRUNCATE ON auth_events
+    FOR EACH STATEMENT EXECUTE FUNCTION reject_auth_events_change();
+
+ALTER TABLE auth_events ADD COLUMN IF NOT EXISTS seq BIGINT UNIQUE;
+ALTER TABLE auth_events ADD COLUMN IF NOT EXISTS prev_hash BYTEA;
+ALTER TABLE auth_events ADD COLUMN IF NOT EXISTS hash BYTEA;
+
+CREATE TABLE IF NOT EXISTS audit_chain_head (
+    id   BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    seq  BIGINT NOT NULL,
+    hash BYTEA NOT NULL
+);
+
+INSERT INTO audit_chain_head (id,seq,hash) VALUES (TRUE,0,'') ON CONFLICT (id) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS audit_checkpoints (
+    seq        BIGINT PRIMARY KEY,
+    hash       BYTEA NOT NULL,
+    kid        TEXT NOT NULL,
+    signature  BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS audit_sink_cursors (
+    name       TEXT PRIMARY KEY,
+    seq        BIGINT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE outbox_events ADD COLUMN IF NOT EXISTS trace_context JSONB;
+
+ALTER TABLE auth_events ADD COLUMN IF NOT EXISTS request_id TEXT NOT NULL DEFAULT '';
+
+-- The TAT (theoretical arrival time) of a key is when its rate limit is
+-- fully available again. The state is rebuilt by the next requests, so it
+-- is not worth writing to the WAL.
+CREATE UNLOGGED TABLE IF NOT EXISTS rate_limits (
+    key TEXT PRIMARY KEY,
+    tat TIMESTAMPTZ NOT NULL
+);
+
+-- The session of the tokens issued for a code, revoked if the code is
+-- replayed.
+ALTER TABLE oauth_codes ADD COLUMN IF NOT EXISTS session_id TEXT;
+
+-- The instance forwarding to a sink and until when, so that no lock is held
+-- while it writes.
+ALTER TABLE audit_sink_cursors ADD COLUMN IF NOT EXISTS leased_by TEXT;
+ALTER TABLE audit_sink_cursors ADD COLUMN IF NOT EXISTS leased_until TIMESTAMPTZ;
+
+-- The version of this schema, checked by /readyz. Bump it along with
+-- postgres.SchemaVersion with every migration, and keep it last.
+CREATE TABLE IF NOT EXISTS schema_version (
+    id      BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    version INT NOT NULL
+);
+
+INSERT INTO schema_version (id,version) VALUES (TRUE,4)
+    ON CONFLICT (id) DO UPDATE SET version=EXCLUDED.version;
@@ -0,0 +1,19 @@
+package postgres
+
+import (
+	"context"
+	"jwt-service/internal/models"
+)
+
+func (p *Postgres) GetAudienceKey(ctx context.Context, audience string) (*models.AudienceKey, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.GetAudienceKey")
+	defer span.End()
+
+	const query = `SELECT audience,jwk,created_at FROM audience_keys WHERE audience=$1`
+
+	var k models.AudienceKey
+	err := p.pool.QueryRow(ctx, query, audience).
+		Scan(&k.Audience, &k.JWK, &k.CreatedAt)
+
+	return &k, err
+}
@@ -0,0 +1,186 @@
+package postgres
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"jwt-service/internal/models"
+	"strconv"
+	"strings"
+)
+
+const authEventColumns = `id,COALESCE(seq,0),event_type,outcome,actor,subject,client_id,session_id,ip,
+         user_agent,reason,request_id,created_at,COALESCE(prev_hash,''),COALESCE(hash,'')`
+
+func (p *Postgres) LockChainHeadTx(ctx context.Context, tx pgx.Tx) (int64, []byte, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.LockChainHeadTx")
+	defer span.End()
+
+	const query = `SELECT seq,hash FROM audit_chain_head WHERE id FOR UPDATE`
+
+	var seq int64
+	var hash []byte
+	err := tx.QueryRow(ctx, query).Scan(&seq, &hash)
+	return seq, hash, err
+}
+
+func (p *Postgres) SaveAuthEventTx(ctx context.Context, tx pgx.Tx, e models.AuthEvent) error {
+	ctx, span := tracer.Start(ctx, "Postgres.SaveAuthEventTx")
+	defer span.End()
+
+	const query = `WITH event AS (
+           INSERT INTO auth_events (seq,event_type,outcome,actor,subject,client_id,session_id,ip,
+             user_agent,reason,request_id,created_at,prev_hash,hash)
+           VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14))
+         UPDATE audit_chain_head SET seq=$1,hash=$14 WHERE id`
+
+	_, err := tx.Exec(ctx, query, e.Seq, e.EventType, e.Outcome, e.Actor, e.Subject,
+		e.ClientID, e.SessionID, e.IP, e.UserAgent, e.Reason, e.RequestID, e.CreatedAt, e.PrevHash, e.Hash)
+	return err
+}
+
+func (p *Postgres) ListAuthEvents(ctx context.Context, filter models.AuthEventFilter,
+	limit int) ([]models.AuthEvent, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.ListAuthEvents")
+	defer span.End()
+
+	where, args := authEventFilterWhere(filter)
+	args = append(args, limit)
+	query := `SELECT ` + authEventColumns + ` FROM auth_events WHERE TRUE` + where + `
+         ORDER BY id DESC LIMIT $` + strconv.Itoa(len(args))
+
+	return p.queryAuthEvents(ctx, query, args...)
+}
+
+func (p *Postgres) GetChainHead(ctx context.Context) (int64, []byte, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.GetChainHead")
+	defer span.End()
+
+	const query = `SELECT seq,hash FROM audit_chain_head WHERE id`
+
+	var seq int64
+	var hash []byte
+	err := p.pool.QueryRow(ctx, query).Scan(&seq, &hash)
+	return seq, hash, err
+}
+
+func (p *Postgres) ListChainedAuthEvents(ctx context.Context, afterSeq int64, limit int) ([]models.AuthEvent, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.ListChainedAuthEvents")
+	defer span.End()
+
+	const query = `SELECT ` + authEventColumns + ` FROM auth_events
+         WHERE seq>$1 ORDER BY seq LIMIT $2`
+
+	return p.queryAuthEvents(ctx, query, afterSeq, limit)
+}
+
+func (p *Postgres) CountUnchainedAuthEvents(ctx context.Context) (int64, int64, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.CountUnchainedAuthEvents")
+	defer span.End()
+
+	const query = `SELECT
+           count(*) FILTER (WHERE start.id IS NULL OR e.id<start.id),
+           count(*) FILTER (WHERE e.id>start.id)
+         FROM auth_events e
+         LEFT JOIN (SELECT min(id) AS id FROM auth_events WHERE seq IS NOT NULL) start ON TRUE
+         WHERE e.seq IS NULL`
+
+	var before, after int64
+	err := p.pool.QueryRow(ctx, query).Scan(&before, &after)
+	return before, after, err
+}
+
+func (p *Postgres) SaveAuditCheckpoint(ctx context.Context, c models.AuditCheckpoint) error {
+	ctx, span := tracer.Start(ctx, "Postgres.SaveAuditCheckpoint")
+	defer span.End()
+
+	const query = `INSERT INTO audit_checkpoints (seq,hash,kid,signature) VALUES ($1,$2,$3,$4)
+         ON CONFLICT (seq) DO NOTHING`
+
+	_, err := p.pool.Exec(ctx, query, c.Seq, c.Hash, c.KID, c.Signature)
+	return err
+}
+
+func (p *Postgres) ListAuditCheckpoints(ctx context.Context) ([]models.AuditCheckpoint, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.ListAuditCheckpoints")
+	defer span.End()
+
+	const query = `SELECT seq,hash,kid,signature,created_at FROM audit_checkpoints ORDER BY seq`
+
+	rows, err := p.pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var checkpoints []models.AuditCheckpoint
+	for rows.Next() {
+		var c models.AuditCheckpoint
+		if err = rows.Scan(&c.Seq, &c.Hash, &c.KID, &c.Signature, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, c)
+	}
+
+	return checkpoints, rows.Err()
+}
+
+func (p *Postgres) queryAuthEvents(ctx context.Context, query string, args ...any) ([]models.AuthEvent, error) {
+	rows, err := p.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.AuthEvent
+	for rows.Next() {
+		var e models.AuthEvent
+		err = rows.Scan(&e.ID, &e.Seq, &e.EventType, &e.Outcome, &e.Actor, &e.Subject, &e.ClientID,
+			&e.SessionID, &e.IP, &e.UserAgent, &e.Reason, &e.RequestID, &e.CreatedAt, &e.PrevHash, &e.Hash)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+func authEventFilterWhere(filter models.AuthEventFilter) (string, []any) {
+	var where strings.Builder
+	var args []any
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		where.WriteString(" AND " + strings.ReplaceAll(cond, "$?", "$"+strconv.Itoa(len(args))))
+	}
+
+	if filter.EventType != "" {
+		add("event_type=$?", filter.EventType)
+	}
+	if filter.Outcome != "" {
+		add("outcome=$?", filter.Outcome)
+	}
+	if filter.Actor != "" {
+		add("actor=$?", filter.Actor)
+	}
+	if filter.Subject != "" {
+		add("subject=$?", filter.Subject)
+	}
+	if filter.ClientID != "" {
+		add("client_id=$?", filter.ClientID)
+	}
+	if filter.IP != nil {
+		// Failed attempts may come without a parsable address.
+		add("CASE WHEN ip<>'' THEN ip::inet<<=$?::inet ELSE FALSE END", filter.IP.String())
+	}
+	if filter.Since != nil {
+		add("created_at>=$?", *filter.Since)
+	}
+	if filter.Until != nil {
+		add("created_at<$?", *filter.Until)
+	}
+	if filter.BeforeID != 0 {
+		add("id<$?", filter.BeforeID)
+	}
+
+	return where.String(), args
+}
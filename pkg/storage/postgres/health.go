@@ -0,0 +1,25 @@
+package postgres
+
+import "context"
+
+// SchemaVersion is the version of migrations/init.sql this code expects,
+// it must be bumped along with the version the migrations record.
+const SchemaVersion = 4
+
+func (p *Postgres) Ping(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "Postgres.Ping")
+	defer span.End()
+
+	return p.pool.Ping(ctx)
+}
+
+func (p *Postgres) GetSchemaVersion(ctx context.Context) (int, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.GetSchemaVersion")
+	defer span.End()
+
+	const query = `SELECT version FROM schema_version WHERE id`
+
+	var version int
+	err := p.pool.QueryRow(ctx, query).Scan(&version)
+	return version, err
+}
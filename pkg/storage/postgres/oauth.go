@@ -0,0 +1,154 @@
+package postgres
+
+import (
+	"context"
+	"jwt-service/internal/models"
+)
+
+func (p *Postgres) GetClient(ctx context.Context, clientID string) (*models.OAuthClient, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.GetClient")
+	defer span.End()
+
+	const query = `SELECT client_id,name,COALESCE(client_secret_hash,''),redirect_uris,
+         COALESCE(token_format,''),created_at
+         FROM oauth_clients WHERE client_id=$1`
+
+	var c models.OAuthClient
+	err := p.pool.QueryRow(ctx, query, clientID).
+		Scan(&c.ID, &c.Name, &c.SecretHash, &c.RedirectURIs, &c.TokenFormat, &c.CreatedAt)
+
+	return &c, err
+}
+
+func (p *Postgres) SaveAuthCode(ctx context.Context, code models.AuthCode) error {
+	ctx, span := tracer.Start(ctx, "Postgres.SaveAuthCode")
+	defer span.End()
+
+	const query = `INSERT INTO oauth_codes
+         (code_hash,client_id,user_id,redirect_uri,code_challenge,expires_at,used)
+         VALUES ($1,$2,$3,$4,$5,$6,false)`
+
+	_, err := p.pool.Exec(ctx, query,
+		code.CodeHash, code.ClientID, code.UserID, code.RedirectURI, code.CodeChallenge, code.ExpiresAt)
+	return err
+}
+
+func (p *Postgres) ConsumeAuthCode(ctx context.Context, codeHash, sessionID string) (*models.AuthCode, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.ConsumeAuthCode")
+	defer span.End()
+
+	const query = `UPDATE oauth_codes c SET used=true,session_id=COALESCE(old.session_id,$2)
+         FROM (SELECT code_hash,used,session_id FROM oauth_codes WHERE code_hash=$1 FOR UPDATE) old
+         WHERE c.code_hash=old.code_hash
+         RETURNING c.code_hash,c.client_id,c.user_id,c.redirect_uri,c.code_challenge,c.expires_at,old.used,
+         c.session_id`
+
+	var d models.AuthCode
+	err := p.pool.QueryRow(ctx, query, codeHash, sessionID).
+		Scan(&d.CodeHash, &d.ClientID, &d.UserID, &d.RedirectURI, &d.CodeChallenge, &d.ExpiresAt, &d.Used,
+			&d.SessionID)
+
+	return &d, err
+}
+
+func (p *Postgres) SaveDeviceCode(ctx context.Context, code models.DeviceCode) error {
+	ctx, span := tracer.Start(ctx, "Postgres.SaveDeviceCode")
+	defer span.End()
+
+	const query = `INSERT INTO oauth_device_codes
+         (device_code_hash,user_code,client_id,status,interval_seconds,expires_at)
+         VALUES ($1,$2,$3,$4,$5,$6)`
+
+	_, err := p.pool.Exec(ctx, query,
+		code.DeviceCodeHash, code.UserCode, code.ClientID, code.Status, code.Interval, code.ExpiresAt)
+	return err
+}
+
+func (p *Postgres) GetDeviceCodeByUserCode(ctx context.Context, userCode string) (*models.DeviceCode, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.GetDeviceCodeByUserCode")
+	defer span.End()
+
+	const query = `SELECT device_code_hash,user_code,client_id,COALESCE(user_id::text,''),status,
+         interval_seconds,expires_at,last_polled_at
+         FROM oauth_device_codes WHERE user_code=$1`
+
+	var d models.DeviceCode
+	err := p.pool.QueryRow(ctx, query, userCode).
+		Scan(&d.DeviceCodeHash, &d.UserCode, &d.ClientID, &d.UserID, &d.Status,
+			&d.Interval, &d.ExpiresAt, &d.LastPolledAt)
+
+	return &d, err
+}
+
+func (p *Postgres) PollDeviceCode(ctx context.Context, deviceCodeHash string) (*models.DeviceCode, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.PollDeviceCode")
+	defer span.End()
+
+	const query = `UPDATE oauth_device_codes c SET last_polled_at=now()
+         FROM (SELECT device_code_hash,last_polled_at FROM oauth_device_codes
+               WHERE device_code_hash=$1 FOR UPDATE) old
+         WHERE c.device_code_hash=old.device_code_hash
+         RETURNING c.device_code_hash,c.user_code,c.client_id,COALESCE(c.user_id::text,''),c.status,
+         c.interval_seconds,c.expires_at,old.last_polled_at`
+
+	var d models.DeviceCode
+	err := p.pool.QueryRow(ctx, query, deviceCodeHash).
+		Scan(&d.DeviceCodeHash, &d.UserCode, &d.ClientID, &d.UserID, &d.Status,
+			&d.Interval, &d.ExpiresAt, &d.LastPolledAt)
+
+	return &d, err
+}
+
+func (p *Postgres) SetDeviceCodeInterval(ctx context.Context, deviceCodeHash string, interval int) error {
+	ctx, span := tracer.Start(ctx, "Postgres.SetDeviceCodeInterval")
+	defer span.End()
+
+	const query = `UPDATE oauth_device_codes SET interval_seconds=$2 WHERE device_code_hash=$1`
+
+	_, err := p.pool.Exec(ctx, query, deviceCodeHash, interval)
+	return err
+}
+
+func (p *Postgres) ResolveDeviceCode(ctx context.Context, userCode, userID, status string) (bool, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.ResolveDeviceCode")
+	defer span.End()
+
+	const query = `UPDATE oauth_device_codes SET status=$3, user_id=$2
+         WHERE user_code=$1 AND status='pending' AND expires_at > now()`
+
+	tag, err := p.pool.Exec(ctx, query, userCode, userID, status)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+func (p *Postgres) ConsumeDeviceCode(ctx context.Context, deviceCodeHash string) (bool, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.ConsumeDeviceCode")
+	defer span.End()
+
+	const query = `UPDATE oauth_device_codes SET status='consumed'
+         WHERE device_code_hash=$1 AND status='approved'`
+
+	tag, err := p.pool.Exec(ctx, query, deviceCodeHash)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+func (p *Postgres) GetExchangePolicy(ctx context.Context, clientID, audience string) (*models.ExchangePolicy, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.GetExchangePolicy")
+	defer span.End()
+
+	const query = `SELECT client_id,audience,scopes,max_ttl_seconds,actor_required
+         FROM token_exchange_policies WHERE client_id=$1 AND audience=$2`
+
+	var e models.ExchangePolicy
+	err := p.pool.QueryRow(ctx, query, clientID, audience).
+		Scan(&e.ClientID, &e.Audience, &e.Scopes, &e.MaxTTLSeconds, &e.ActorRequired)
+
+	return &e, err
+}
@@ -0,0 +1,119 @@
+package postgres
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"jwt-service/internal/models"
+	"time"
+)
+
+const outboxColumns = `id,event_type,target,COALESCE(subscription_id::text,''),payload,status,
+         attempts,next_attempt_at,COALESCE(last_error,''),created_at,delivered_at,
+         COALESCE(trace_context,'{}')`
+
+func (p *Postgres) SaveOutboxEventTx(ctx context.Context, tx pgx.Tx, event models.OutboxEvent) error {
+	ctx, span := tracer.Start(ctx, "Postgres.SaveOutboxEventTx")
+	defer span.End()
+
+	const query = `INSERT INTO outbox_events (event_type,target,payload,trace_context) VALUES ($1,$2,$3,$4)`
+
+	_, err := tx.Exec(ctx, query, event.EventType, event.Target, event.Payload, event.TraceContext)
+	return err
+}
+
+func (p *Postgres) SaveSubscribedEventsTx(ctx context.Context, tx pgx.Tx, event models.OutboxEvent) error {
+	ctx, span := tracer.Start(ctx, "Postgres.SaveSubscribedEventsTx")
+	defer span.End()
+
+	const query = `INSERT INTO outbox_events (event_type,target,payload,trace_context,subscription_id)
+         SELECT $1,url,$2,$3,id FROM webhook_subscriptions
+         WHERE cardinality(event_types)=0 OR $1=ANY(event_types)`
+
+	_, err := tx.Exec(ctx, query, event.EventType, event.Payload, event.TraceContext)
+	return err
+}
+
+func (p *Postgres) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.ClaimOutboxEvents")
+	defer span.End()
+
+	const query = `UPDATE outbox_events SET next_attempt_at=now()+$2::interval
+         WHERE id IN (
+           SELECT id FROM outbox_events
+           WHERE status='pending' AND next_attempt_at<=now()
+           ORDER BY id LIMIT $1
+           FOR UPDATE SKIP LOCKED)
+         RETURNING ` + outboxColumns
+
+	return p.queryOutboxEvents(ctx, query, limit, lease)
+}
+
+func (p *Postgres) MarkOutboxDelivered(ctx context.Context, id int64) error {
+	ctx, span := tracer.Start(ctx, "Postgres.MarkOutboxDelivered")
+	defer span.End()
+
+	const query = `UPDATE outbox_events
+         SET status='delivered',attempts=attempts+1,delivered_at=now(),last_error=NULL
+         WHERE id=$1`
+
+	_, err := p.pool.Exec(ctx, query, id)
+	return err
+}
+
+func (p *Postgres) MarkOutboxFailed(ctx context.Context, id int64, lastError string, retryIn time.Duration,
+	dead bool) error {
+	ctx, span := tracer.Start(ctx, "Postgres.MarkOutboxFailed")
+	defer span.End()
+
+	const query = `UPDATE outbox_events
+         SET status=CASE WHEN $4 THEN 'dead' ELSE 'pending' END,
+         attempts=attempts+1,next_attempt_at=now()+$3::interval,last_error=$2
+         WHERE id=$1`
+
+	_, err := p.pool.Exec(ctx, query, id, lastError, retryIn, dead)
+	return err
+}
+
+func (p *Postgres) ListOutboxEvents(ctx context.Context, status string, limit int) ([]models.OutboxEvent, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.ListOutboxEvents")
+	defer span.End()
+
+	const query = `SELECT ` + outboxColumns + ` FROM outbox_events
+         WHERE $1::text='' OR status=$1::text
+         ORDER BY id DESC LIMIT $2`
+
+	return p.queryOutboxEvents(ctx, query, status, limit)
+}
+
+func (p *Postgres) RedeliverOutboxEventTx(ctx context.Context, tx pgx.Tx, id int64) (bool, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.RedeliverOutboxEventTx")
+	defer span.End()
+
+	const query = `UPDATE outbox_events
+         SET status='pending',attempts=0,next_attempt_at=now(),delivered_at=NULL
+         WHERE id=$1`
+
+	tag, err := tx.Exec(ctx, query, id)
+	return tag.RowsAffected() > 0, err
+}
+
+func (p *Postgres) queryOutboxEvents(ctx context.Context, query string, args ...any) ([]models.OutboxEvent, error) {
+	rows, err := p.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.OutboxEvent
+	for rows.Next() {
+		var e models.OutboxEvent
+		err = rows.Scan(&e.ID, &e.EventType, &e.Target, &e.SubscriptionID, &e.Payload, &e.Status, &e.Attempts,
+			&e.NextAttemptAt, &e.LastError, &e.CreatedAt, &e.DeliveredAt, &e.TraceContext)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
@@ -2,95 +2,209 @@ package postgres
 
 import (
 	"context"
+	"fmt"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"jwt-service/internal/config"
+	errors2 "jwt-service/internal/errors"
 	"jwt-service/internal/models"
+	"sync/atomic"
 )
 
 type Postgres struct {
 	pool *pgxpool.Pool
+
+	// credentials are those new connections are opened with. They change
+	// when the configuration is reloaded, open connections keep theirs.
+	credentials atomic.Pointer[credentials]
+}
+
+type credentials struct {
+	user     string
+	password string
 }
 
 func New(connStr string) (*Postgres, error) {
-	pool, err := pgxpool.New(context.Background(), connStr)
+	poolConfig, err := pgxpool.ParseConfig(connStr)
+	if err != nil {
+		return nil, err
+	}
+	poolConfig.ConnConfig.Tracer = queryTracer{}
+
+	p := &Postgres{}
+	p.credentials.Store(&credentials{
+		user:     poolConfig.ConnConfig.User,
+		password: poolConfig.ConnConfig.Password,
+	})
+	poolConfig.BeforeConnect = func(_ context.Context, connConfig *pgx.ConnConfig) error {
+		c := p.credentials.Load()
+		connConfig.User = c.user
+		connConfig.Password = c.password
+		return nil
+	}
+
+	p.pool, err = pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
 		return nil, err
 	}
 
-	err = pool.Ping(context.Background())
+	err = p.pool.Ping(context.Background())
 	if err != nil {
 		return nil, err
 	}
 
-	return &Postgres{
-		pool: pool,
-	}, nil
+	return p, nil
+}
+
+// PrepareReload checks that the database accepts the credentials of cfg,
+// which new connections are then opened with.
+func (p *Postgres) PrepareReload(ctx context.Context, cfg *config.Config) (func(), error) {
+	next := &credentials{user: cfg.PgUser, password: cfg.PgPass}
+	if *next == *p.credentials.Load() {
+		return func() {}, nil
+	}
+
+	connConfig := p.pool.Config().ConnConfig.Copy()
+	connConfig.User = next.user
+	connConfig.Password = next.password
+	conn, err := pgx.ConnectConfig(ctx, connConfig)
+	if err != nil {
+		return nil, fmt.Errorf("POSTGRES_USER, POSTGRES_PASSWORD: %w", err)
+	}
+	_ = conn.Close(ctx)
+
+	return func() { p.credentials.Store(next) }, nil
 }
 
-func (p *Postgres) BeginTx() (pgx.Tx, error) {
-	return p.pool.Begin(context.Background())
+func (p *Postgres) BeginTx(ctx context.Context) (pgx.Tx, error) {
+	return p.pool.Begin(ctx)
 }
 
 func (p *Postgres) Close() {
 	p.pool.Close()
 }
 
-func (p *Postgres) GetRefreshData(jti string) (*models.RefreshData, error) {
-	const query = `SELECT jti,user_id,hash,user_agent,ip,issued_at,revoked
+// Stat returns the statistics of the connection pool.
+func (p *Postgres) Stat() *pgxpool.Stat {
+	return p.pool.Stat()
+}
+
+func (p *Postgres) GetRefreshData(ctx context.Context, jti string) (*models.RefreshData, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.GetRefreshData")
+	defer span.End()
+
+	const query = `SELECT jti,user_id,hash,user_agent,ip,issued_at,revoked,COALESCE(jkt,''),COALESCE(x5t,''),
+         COALESCE(session_id::text,'')
          FROM refresh_tokens WHERE jti=$1`
 
 	var d models.RefreshData
-	err := p.pool.QueryRow(context.Background(), query, jti).
-		Scan(&d.JTI, &d.UserID, &d.Hash, &d.UserAgent, &d.IP, &d.IssuedAt, &d.Revoked)
+	err := p.pool.QueryRow(ctx, query, jti).
+		Scan(&d.JTI, &d.UserID, &d.Hash, &d.UserAgent, &d.IP, &d.IssuedAt, &d.Revoked, &d.JKT, &d.X5T, &d.SessionID)
 
 	return &d, err
 }
 
-func (p *Postgres) RevokeRefresh(jti string) error {
+func (p *Postgres) RevokeRefresh(ctx context.Context, jti string) error {
+	ctx, span := tracer.Start(ctx, "Postgres.RevokeRefresh")
+	defer span.End()
+
 	const query = `UPDATE refresh_tokens SET revoked=true WHERE jti=$1`
 
-	_, err := p.pool.Exec(context.Background(), query, jti)
+	_, err := p.pool.Exec(ctx, query, jti)
 
 	return err
 }
 
-func (p *Postgres) IsJWTBlacklisted(jti string) (bool, error) {
+func (p *Postgres) IsJWTBlacklisted(ctx context.Context, jti string) (bool, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.IsJWTBlacklisted")
+	defer span.End()
+
 	const query = `SELECT EXISTS(SELECT 1 FROM jwt_blacklist WHERE jti=$1)`
 
 	var exists bool
-	err := p.pool.QueryRow(context.Background(), query, jti).
+	err := p.pool.QueryRow(ctx, query, jti).
 		Scan(&exists)
 
 	return exists, err
 }
 
-func (p *Postgres) SaveRefreshTx(tx pgx.Tx, data models.RefreshData) error {
+func (p *Postgres) GetTokenVersion(ctx context.Context, userID string) (int64, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.GetTokenVersion")
+	defer span.End()
+
+	const query = `SELECT COALESCE((SELECT version FROM user_token_versions WHERE user_id=$1),0)`
+
+	var version int64
+	err := p.pool.QueryRow(ctx, query, userID).
+		Scan(&version)
+
+	return version, err
+}
+
+func (p *Postgres) BumpTokenVersion(ctx context.Context, userID string) (int64, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.BumpTokenVersion")
+	defer span.End()
+
+	const query = `INSERT INTO user_token_versions (user_id,version) VALUES ($1,1)
+         ON CONFLICT (user_id) DO UPDATE
+         SET version=user_token_versions.version+1,updated_at=now()
+         RETURNING version`
+
+	var version int64
+	err := p.pool.QueryRow(ctx, query, userID).
+		Scan(&version)
+
+	return version, err
+}
+
+func (p *Postgres) SaveRefreshTx(ctx context.Context, tx pgx.Tx, data models.RefreshData) error {
+	ctx, span := tracer.Start(ctx, "Postgres.SaveRefreshTx")
+	defer span.End()
+
 	const query = `INSERT INTO refresh_tokens
-         (jti,user_id,hash,user_agent,ip,issued_at,revoked)
-         VALUES ($1,$2,$3,$4,$5,$6,false)`
+         (jti,user_id,hash,user_agent,ip,issued_at,revoked,jkt,x5t,session_id)
+         VALUES ($1,$2,$3,$4,$5,$6,false,NULLIF($7,''),NULLIF($8,''),NULLIF($9,'')::uuid)`
 
-	_, err := tx.Exec(context.Background(), query,
-		data.JTI, data.UserID, data.Hash, data.UserAgent, data.IP, data.IssuedAt)
+	_, err := tx.Exec(ctx, query,
+		data.JTI, data.UserID, data.Hash, data.UserAgent, data.IP, data.IssuedAt, data.JKT, data.X5T, data.SessionID)
 	return err
 }
 
-func (p *Postgres) RevokeRefreshTx(tx pgx.Tx, jti string) error {
-	const query = `UPDATE refresh_tokens SET revoked=true WHERE jti=$1`
+func (p *Postgres) RevokeRefreshTx(ctx context.Context, tx pgx.Tx, jti string) error {
+	ctx, span := tracer.Start(ctx, "Postgres.RevokeRefreshTx")
+	defer span.End()
 
-	_, err := tx.Exec(context.Background(), query, jti)
-	return err
+	// A concurrent revocation holds the row lock until it commits, then the
+	// condition is checked again and the row no longer matches.
+	const query = `UPDATE refresh_tokens SET revoked=true WHERE jti=$1 AND NOT revoked`
+
+	tag, err := tx.Exec(ctx, query, jti)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return errors2.ErrInvalidToken
+	}
+
+	return nil
 }
 
-func (p *Postgres) RevokeAllRefreshTx(tx pgx.Tx, userID string) error {
+func (p *Postgres) RevokeAllRefreshTx(ctx context.Context, tx pgx.Tx, userID string) error {
+	ctx, span := tracer.Start(ctx, "Postgres.RevokeAllRefreshTx")
+	defer span.End()
+
 	const query = `UPDATE refresh_tokens SET revoked=true WHERE user_id=$1`
 
-	_, err := tx.Exec(context.Background(), query, userID)
+	_, err := tx.Exec(ctx, query, userID)
 	return err
 }
 
-func (p *Postgres) BlacklistJWTTx(tx pgx.Tx, jti string) error {
+func (p *Postgres) BlacklistJWTTx(ctx context.Context, tx pgx.Tx, jti string) error {
+	ctx, span := tracer.Start(ctx, "Postgres.BlacklistJWTTx")
+	defer span.End()
+
 	const query = `INSERT INTO jwt_blacklist (jti) VALUES ($1) ON CONFLICT DO NOTHING`
 
-	_, err := tx.Exec(context.Background(), query, jti)
+	_, err := tx.Exec(ctx, query, jti)
 	return err
 }
@@ -0,0 +1,47 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+func (p *Postgres) ReserveRateLimit(ctx context.Context, key string, now time.Time,
+	interval, window time.Duration) (time.Time, bool, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.ReserveRateLimit")
+	defer span.End()
+
+	// $2 - $3 is the interval and $4 the latest TAT allowed.
+	const reserve = `INSERT INTO rate_limits AS r (key,tat) VALUES ($1,$2)
+         ON CONFLICT (key) DO UPDATE SET tat=GREATEST(r.tat,$3)+($2-$3)
+         WHERE GREATEST(r.tat,$3)+($2-$3) <= $4
+         RETURNING tat`
+	const query = `SELECT tat FROM rate_limits WHERE key=$1`
+
+	var tat time.Time
+	err := p.pool.QueryRow(ctx, reserve, key, now.Add(interval), now, now.Add(window)).Scan(&tat)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = p.pool.QueryRow(ctx, query, key).Scan(&tat)
+		return tat, false, err
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	return tat, true, nil
+}
+
+func (p *Postgres) DeleteExpiredRateLimits(ctx context.Context, before time.Time) (int64, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.DeleteExpiredRateLimits")
+	defer span.End()
+
+	const query = `DELETE FROM rate_limits WHERE tat<$1`
+
+	tag, err := p.pool.Exec(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
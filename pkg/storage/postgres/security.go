@@ -0,0 +1,105 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"jwt-service/internal/models"
+	"time"
+)
+
+func (p *Postgres) GetTokenNotBefore(ctx context.Context) (time.Time, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.GetTokenNotBefore")
+	defer span.End()
+
+	const query = `SELECT token_not_before FROM security_settings WHERE id`
+
+	var notBefore *time.Time
+	err := p.pool.QueryRow(ctx, query).
+		Scan(&notBefore)
+	// Without a row or a cutoff no token is rejected by its age. Any other
+	// error must reach the caller, which would otherwise accept every
+	// token while the database is failing.
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	if notBefore == nil {
+		return time.Time{}, nil
+	}
+
+	return *notBefore, nil
+}
+
+func (p *Postgres) GetSigningKeys(ctx context.Context) ([]models.SigningKey, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.GetSigningKeys")
+	defer span.End()
+
+	const query = `SELECT kid,secret,created_at FROM signing_keys
+         WHERE retired_at IS NULL ORDER BY created_at DESC`
+
+	rows, err := p.pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []models.SigningKey
+	for rows.Next() {
+		var k models.SigningKey
+		if err = rows.Scan(&k.KID, &k.Secret, &k.CreatedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	return keys, rows.Err()
+}
+
+func (p *Postgres) SetTokenNotBeforeTx(ctx context.Context, tx pgx.Tx, notBefore time.Time) error {
+	ctx, span := tracer.Start(ctx, "Postgres.SetTokenNotBeforeTx")
+	defer span.End()
+
+	const query = `INSERT INTO security_settings (id,token_not_before) VALUES (true,$1)
+         ON CONFLICT (id) DO UPDATE SET token_not_before=EXCLUDED.token_not_before`
+
+	_, err := tx.Exec(ctx, query, notBefore)
+	return err
+}
+
+func (p *Postgres) RevokeRefreshIssuedBeforeTx(ctx context.Context, tx pgx.Tx, t time.Time) (int64, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.RevokeRefreshIssuedBeforeTx")
+	defer span.End()
+
+	const query = `UPDATE refresh_tokens SET revoked=true WHERE issued_at<$1 AND NOT revoked`
+
+	tag, err := tx.Exec(ctx, query, t)
+	return tag.RowsAffected(), err
+}
+
+func (p *Postgres) RotateSigningKeyTx(ctx context.Context, tx pgx.Tx, key models.SigningKey) error {
+	ctx, span := tracer.Start(ctx, "Postgres.RotateSigningKeyTx")
+	defer span.End()
+
+	const retireQuery = `UPDATE signing_keys SET retired_at=now() WHERE retired_at IS NULL`
+	const insertQuery = `INSERT INTO signing_keys (kid,secret,created_at) VALUES ($1,$2,$3)`
+
+	if _, err := tx.Exec(ctx, retireQuery); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(ctx, insertQuery, key.KID, key.Secret, key.CreatedAt)
+	return err
+}
+
+func (p *Postgres) SaveAdminActionTx(ctx context.Context, tx pgx.Tx, action models.AdminAction) error {
+	ctx, span := tracer.Start(ctx, "Postgres.SaveAdminActionTx")
+	defer span.End()
+
+	const query = `INSERT INTO admin_actions (action,actor,reason,details) VALUES ($1,$2,$3,$4)`
+
+	_, err := tx.Exec(ctx, query, action.Action, action.Actor, action.Reason, action.Details)
+	return err
+}
@@ -0,0 +1,168 @@
+package postgres
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"jwt-service/internal/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rows issued before sessions were introduced have no session_id, each of
+// them is treated as a session of its own.
+const sessionIDExpr = `COALESCE(session_id::text,jti)`
+
+func (p *Postgres) ListSessions(ctx context.Context, userID string) ([]models.Session, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.ListSessions")
+	defer span.End()
+
+	const query = `SELECT ` + sessionIDExpr + ` AS sid,user_id,
+         (array_agg(user_agent ORDER BY issued_at DESC))[1],
+         (array_agg(ip ORDER BY issued_at DESC))[1],
+         MIN(issued_at),MAX(issued_at)
+         FROM refresh_tokens WHERE user_id=$1
+         GROUP BY sid,user_id HAVING bool_or(NOT revoked)
+         ORDER BY MAX(issued_at) DESC`
+
+	rows, err := p.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		var s models.Session
+		if err = rows.Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IP, &s.FirstSeen, &s.LastUsed); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (p *Postgres) RevokeSessionTx(ctx context.Context, tx pgx.Tx, userID, sessionID string,
+	accessIssuedAfter time.Time) (bool, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.RevokeSessionTx")
+	defer span.End()
+
+	const revokeQuery = `UPDATE refresh_tokens SET revoked=true
+         WHERE user_id=$1 AND ` + sessionIDExpr + `=$2 AND NOT revoked`
+
+	tag, err := tx.Exec(ctx, revokeQuery, userID, sessionID)
+	if err != nil || tag.RowsAffected() == 0 {
+		return false, err
+	}
+
+	// Every access token shares its jti with the refresh token issued with
+	// it, including those of already rotated refresh tokens.
+	const blacklistQuery = `INSERT INTO jwt_blacklist (jti)
+         SELECT jti FROM refresh_tokens
+         WHERE user_id=$1 AND ` + sessionIDExpr + `=$2 AND issued_at>$3
+         ON CONFLICT DO NOTHING`
+
+	_, err = tx.Exec(ctx, blacklistQuery, userID, sessionID, accessIssuedAfter)
+
+	return err == nil, err
+}
+
+func (p *Postgres) SearchSessions(ctx context.Context, filter models.SessionFilter, limit int) ([]models.Session, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.SearchSessions")
+	defer span.End()
+
+	where, args := sessionFilterWhere(filter)
+	args = append(args, limit)
+	query := `WITH matched AS (
+           SELECT DISTINCT user_id,` + sessionIDExpr + ` AS sid FROM refresh_tokens
+           WHERE NOT revoked` + where + `)
+         SELECT r.sid,r.user_id,
+         (array_agg(r.user_agent ORDER BY r.issued_at DESC))[1],
+         (array_agg(r.ip ORDER BY r.issued_at DESC))[1],
+         MIN(r.issued_at),MAX(r.issued_at)
+         FROM (SELECT *,` + sessionIDExpr + ` AS sid FROM refresh_tokens) r
+         JOIN matched m ON m.user_id=r.user_id AND m.sid=r.sid
+         GROUP BY r.sid,r.user_id
+         ORDER BY MAX(r.issued_at) DESC
+         LIMIT $` + strconv.Itoa(len(args))
+
+	rows, err := p.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		var s models.Session
+		if err = rows.Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IP, &s.FirstSeen, &s.LastUsed); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (p *Postgres) RevokeSessionsTx(ctx context.Context, tx pgx.Tx, filter models.SessionFilter,
+	accessIssuedAfter time.Time) (int64, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.RevokeSessionsTx")
+	defer span.End()
+
+	where, args := sessionFilterWhere(filter)
+	args = append(args, accessIssuedAfter)
+	// The current refresh token of a session is its only non-revoked one, so
+	// revoking the matching tokens revokes the matching sessions.
+	query := `WITH revoked AS (
+           UPDATE refresh_tokens SET revoked=true
+           WHERE NOT revoked` + where + `
+           RETURNING user_id,` + sessionIDExpr + ` AS sid),
+         blacklisted AS (
+           INSERT INTO jwt_blacklist (jti)
+           SELECT r.jti FROM refresh_tokens r
+           JOIN revoked v ON v.user_id=r.user_id AND v.sid=COALESCE(r.session_id::text,r.jti)
+           WHERE r.issued_at>$` + strconv.Itoa(len(args)) + `
+           ON CONFLICT DO NOTHING)
+         SELECT COUNT(*) FROM revoked`
+
+	var count int64
+	err := tx.QueryRow(ctx, query, args...).
+		Scan(&count)
+
+	return count, err
+}
+
+// sessionFilterWhere renders filter as conditions on refresh_tokens to be
+// appended to a WHERE clause, with their arguments numbered from $1.
+func sessionFilterWhere(filter models.SessionFilter) (string, []any) {
+	var where strings.Builder
+	var args []any
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		where.WriteString(" AND " + strings.ReplaceAll(cond, "$?", "$"+strconv.Itoa(len(args))))
+	}
+
+	if filter.UserID != "" {
+		add("user_id=$?", filter.UserID)
+	}
+	if filter.IP != nil {
+		// Tokens issued without a parsable address have an empty ip.
+		add("CASE WHEN ip<>'' THEN ip::inet<<=$?::inet ELSE FALSE END", filter.IP.String())
+	}
+	if filter.UserAgent != "" {
+		add(`user_agent ILIKE '%' || $? || '%'`, escapeLike(filter.UserAgent))
+	}
+	if filter.IssuedAfter != nil {
+		add("issued_at>=$?", *filter.IssuedAfter)
+	}
+	if filter.IssuedBefore != nil {
+		add("issued_at<$?", *filter.IssuedBefore)
+	}
+
+	return where.String(), args
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
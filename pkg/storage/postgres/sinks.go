@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+func (p *Postgres) ClaimSinkCursor(ctx context.Context, name, owner string, lease time.Duration) (int64, bool, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.ClaimSinkCursor")
+	defer span.End()
+
+	const insert = `INSERT INTO audit_sink_cursors (name,seq)
+         SELECT $1,seq FROM audit_chain_head WHERE id
+         ON CONFLICT (name) DO NOTHING`
+	const query = `UPDATE audit_sink_cursors SET leased_by=$2,leased_until=now()+$3::interval
+         WHERE name=$1 AND (leased_by IS NULL OR leased_by=$2 OR leased_until<now())
+         RETURNING seq`
+
+	if _, err := p.pool.Exec(ctx, insert, name); err != nil {
+		return 0, false, err
+	}
+
+	var seq int64
+	err := p.pool.QueryRow(ctx, query, name, owner, lease).Scan(&seq)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	return seq, true, nil
+}
+
+func (p *Postgres) AdvanceSinkCursor(ctx context.Context, name, owner string, from, to int64) (bool, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.AdvanceSinkCursor")
+	defer span.End()
+
+	const query = `UPDATE audit_sink_cursors SET seq=$4,updated_at=now()
+         WHERE name=$1 AND leased_by=$2 AND seq=$3`
+
+	tag, err := p.pool.Exec(ctx, query, name, owner, from, to)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+func (p *Postgres) ReleaseSinkCursor(ctx context.Context, name, owner string) error {
+	ctx, span := tracer.Start(ctx, "Postgres.ReleaseSinkCursor")
+	defer span.End()
+
+	const query = `UPDATE audit_sink_cursors SET leased_by=NULL,leased_until=NULL
+         WHERE name=$1 AND leased_by=$2`
+
+	_, err := p.pool.Exec(ctx, query, name, owner)
+	return err
+}
@@ -0,0 +1,71 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"jwt-service/internal/metrics"
+	"strings"
+	"time"
+)
+
+var tracer = otel.Tracer("jwt-service/pkg/storage/postgres")
+
+type queryStartKey struct{}
+
+type queryStart struct {
+	statement string
+	at        time.Time
+	span      trace.Span
+}
+
+// queryTracer traces every query in a client span and records its duration
+// in the db_query_duration_seconds histogram, labelled by the statement's
+// leading keyword to keep the number of series small.
+type queryTracer struct{}
+
+func (queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	stmt := statement(data.SQL)
+	ctx, span := tracer.Start(ctx, strings.ToUpper(stmt), trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemNamePostgreSQL,
+			semconv.DBOperationName(stmt),
+			semconv.DBQueryText(data.SQL),
+		))
+
+	return context.WithValue(ctx, queryStartKey{}, queryStart{statement: stmt, at: time.Now(), span: span})
+}
+
+func (queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	start, ok := ctx.Value(queryStartKey{}).(queryStart)
+	if !ok {
+		return
+	}
+	defer start.span.End()
+
+	outcome := "ok"
+	if data.Err != nil && !errors.Is(data.Err, pgx.ErrNoRows) {
+		outcome = "error"
+		start.span.RecordError(data.Err)
+		start.span.SetStatus(codes.Error, data.Err.Error())
+	}
+	metrics.DBQueryDuration.WithLabelValues(start.statement, outcome).Observe(time.Since(start.at).Seconds())
+}
+
+func statement(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "other"
+	}
+
+	switch keyword := strings.ToLower(fields[0]); keyword {
+	case "select", "insert", "update", "delete", "with", "begin", "commit", "rollback":
+		return keyword
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"jwt-service/internal/models"
+)
+
+func (p *Postgres) GetWebhookSecret(ctx context.Context, subscriptionID string) (string, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.GetWebhookSecret")
+	defer span.End()
+
+	const query = `SELECT secret FROM webhook_subscriptions WHERE id=$1`
+
+	var secret string
+	err := p.pool.QueryRow(ctx, query, subscriptionID).Scan(&secret)
+	return secret, err
+}
+
+func (p *Postgres) ListWebhookSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.ListWebhookSubscriptions")
+	defer span.End()
+
+	const query = `SELECT id,url,event_types,created_at FROM webhook_subscriptions ORDER BY created_at`
+
+	rows, err := p.pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []models.WebhookSubscription
+	for rows.Next() {
+		var s models.WebhookSubscription
+		if err = rows.Scan(&s.ID, &s.URL, &s.EventTypes, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		subs = append(subs, s)
+	}
+
+	return subs, rows.Err()
+}
+
+func (p *Postgres) SaveWebhookSubscriptionTx(ctx context.Context, tx pgx.Tx, sub models.WebhookSubscription) error {
+	ctx, span := tracer.Start(ctx, "Postgres.SaveWebhookSubscriptionTx")
+	defer span.End()
+
+	const query = `INSERT INTO webhook_subscriptions (id,url,secret,event_types,created_at)
+         VALUES ($1,$2,$3,$4,$5)`
+
+	_, err := tx.Exec(ctx, query, sub.ID, sub.URL, sub.Secret, sub.EventTypes, sub.CreatedAt)
+	return err
+}
+
+func (p *Postgres) DeleteWebhookSubscriptionTx(ctx context.Context, tx pgx.Tx, id string) (bool, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.DeleteWebhookSubscriptionTx")
+	defer span.End()
+
+	const query = `DELETE FROM webhook_subscriptions WHERE id=$1`
+
+	tag, err := tx.Exec(ctx, query, id)
+	return tag.RowsAffected() > 0, err
+}